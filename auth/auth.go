@@ -0,0 +1,140 @@
+// Package auth authenticates bearer tokens on incoming RPCs and authorizes the
+// resulting principal against a per-RPC policy.
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ErrInvalidToken is returned by an Authenticator that does not recognise a token
+var ErrInvalidToken = errors.New("invalid token")
+
+// Principal is the authenticated caller of an RPC
+type Principal struct {
+	// Name identifies the caller, the policy is keyed on it
+	Name string
+}
+
+// Authenticator turns a bearer token into a Principal
+type Authenticator interface {
+	Authenticate(token string) (*Principal, error)
+}
+
+// Chain tries each Authenticator in turn and returns the first Principal found
+type Chain []Authenticator
+
+// Authenticate implements Authenticator
+func (c Chain) Authenticate(token string) (*Principal, error) {
+	for _, a := range c {
+		if p, err := a.Authenticate(token); err == nil {
+			return p, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal placed on ctx by the auth interceptors
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// UnaryServerInterceptor authenticates and authorizes unary RPCs.
+// Methods whose full name starts with one of the public prefixes skip auth entirely,
+// e.g. "/grpc.health.v1.Health/" so load balancers can health check without a token.
+func UnaryServerInterceptor(a Authenticator, policy *Policy, public ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isPublic(info.FullMethod, public) {
+			return handler(ctx, req)
+		}
+		ctx, err := authorize(ctx, a, policy, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authenticates and authorizes streaming RPCs, see UnaryServerInterceptor for public.
+func StreamServerInterceptor(a Authenticator, policy *Policy, public ...string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isPublic(info.FullMethod, public) {
+			return handler(srv, ss)
+		}
+		ctx, err := authorize(ss.Context(), a, policy, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// isPublic checks if fullMethod starts with one of the public prefixes
+func isPublic(fullMethod string, public []string) bool {
+	for _, prefix := range public {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize checks the bearer token on ctx and returns ctx with the principal on it
+func authorize(ctx context.Context, a Authenticator, policy *Policy, fullMethod string) (context.Context, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := a.Authenticate(token)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid bearer token")
+	}
+	if !policy.Allowed(p, fullMethod) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s may not call %s", p.Name, fullMethod)
+	}
+	return NewContext(ctx, p), nil
+}
+
+// bearerToken extracts the token from the "authorization: Bearer <token>" header
+func bearerToken(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", status.Errorf(codes.Unauthenticated, "missing metadata")
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", status.Errorf(codes.Unauthenticated, "missing authorization header")
+	}
+	const prefix = "bearer "
+	if len(values[0]) <= len(prefix) || !strings.EqualFold(values[0][:len(prefix)], prefix) {
+		return "", status.Errorf(codes.Unauthenticated, "authorization header is not a bearer token")
+	}
+	return values[0][len(prefix):], nil
+}
+
+// contextStream swaps the context of a ServerStream so handlers see the principal
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,386 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// now is the time the test verifier's clock is stopped at
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVerifier(t, map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey})
+	v.Issuer = "https://issuer.example.com"
+	v.Audience = "route-guide"
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://issuer.example.com",
+			"aud": "route-guide",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{name: "RS256", token: signRS256(t, rsaKey, "rsa", valid()), ok: true},
+		{name: "ES256", token: signES256(t, ecKey, "ec", valid()), ok: true},
+		{name: "expired", token: signES256(t, ecKey, "ec", with("exp", now.Add(-2*clockSkew).Unix()))},
+		{name: "expired within the skew", token: signES256(t, ecKey, "ec", with("exp", now.Add(-clockSkew/2).Unix())), ok: true},
+		{name: "not yet valid", token: signES256(t, ecKey, "ec", with("nbf", now.Add(2*clockSkew).Unix()))},
+		{name: "not yet valid within the skew", token: signES256(t, ecKey, "ec", with("nbf", now.Add(clockSkew/2).Unix())), ok: true},
+		{name: "missing exp", token: signES256(t, ecKey, "ec", with("exp", nil))},
+		{name: "missing sub", token: signES256(t, ecKey, "ec", with("sub", nil))},
+		{name: "other issuer", token: signES256(t, ecKey, "ec", with("iss", "https://evil.example.com"))},
+		{name: "other audience", token: signES256(t, ecKey, "ec", with("aud", "billing"))},
+		{name: "audience array", token: signES256(t, ecKey, "ec", with("aud", []string{"billing", "route-guide"})), ok: true},
+		{name: "audience array without ours", token: signES256(t, ecKey, "ec", with("aud", []string{"billing", "maps"}))},
+		{name: "missing audience", token: signES256(t, ecKey, "ec", with("aud", nil))},
+		{name: "RS alg on an EC key", token: signRS256(t, rsaKey, "ec", valid())},
+		{name: "ES alg on an RSA key", token: signES256(t, ecKey, "rsa", valid())},
+		{name: "unknown kid", token: signES256(t, ecKey, "other", valid())},
+		{name: "ES signature of the wrong length", token: truncateSignature(t, signES256(t, ecKey, "ec", valid()))},
+		{name: "tampered claims", token: swapClaims(signES256(t, ecKey, "ec", valid()), with("sub", "mallory"))},
+		{name: "alg none", token: encodeSegment(t, map[string]string{"alg": "none", "kid": "ec"}) + "." + encodeSegment(t, valid()) + "."},
+		{name: "not a JWT", token: "s3cr3t"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Authenticate(tt.token)
+			if !tt.ok {
+				if err != ErrInvalidToken {
+					t.Errorf("Authenticate = %v, %v, want ErrInvalidToken", p, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if p.Name != "alice" {
+				t.Errorf("principal = %q, want alice", p.Name)
+			}
+		})
+	}
+}
+
+func TestLoadJWKSFileSkipsEncryptionKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	enc := ecJWK("enc", &ecKey.PublicKey)
+	enc["use"] = "enc"
+	writeJSON(t, path, map[string]interface{}{"keys": []interface{}{enc}})
+	if _, err := LoadJWKSFile(path); err == nil {
+		t.Error("LoadJWKSFile accepted a set without signing keys")
+	}
+}
+
+func TestStaticTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	file := "# token        principal\n\ns3cr3t-admin   admin\n  s3cr3t-mobile  mobile-app\n"
+	if err := ioutil.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := LoadTokenFile(path)
+	if err != nil {
+		t.Fatalf("LoadTokenFile: %v", err)
+	}
+	tests := map[string]string{"s3cr3t-admin": "admin", "s3cr3t-mobile": "mobile-app", "admin": "", "": ""}
+	for token, want := range tests {
+		p, err := tokens.Authenticate(token)
+		if want == "" {
+			if err != ErrInvalidToken {
+				t.Errorf("Authenticate(%q) = %v, %v, want ErrInvalidToken", token, p, err)
+			}
+			continue
+		}
+		if err != nil || p.Name != want {
+			t.Errorf("Authenticate(%q) = %v, %v, want %s", token, p, err, want)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, []byte("token-without-principal\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTokenFile(path); err == nil {
+		t.Error("LoadTokenFile accepted a line without a principal")
+	}
+}
+
+func TestPolicyAllowed(t *testing.T) {
+	policy := &Policy{
+		Principals: map[string][]string{
+			"admin":      {"*"},
+			"mobile-app": {"GetFeature", "/protos.RouteGuide/ListFeatures"},
+		},
+		Default: []string{"SearchFeatures"},
+	}
+	tests := []struct {
+		principal string
+		method    string
+		want      bool
+	}{
+		{principal: "admin", method: "/protos.RouteGuide/RouteChat", want: true},
+		{principal: "mobile-app", method: "/protos.RouteGuide/GetFeature", want: true},
+		{principal: "mobile-app", method: "/protos.RouteGuide/ListFeatures", want: true},
+		{principal: "mobile-app", method: "/protos.RouteGuide/RecordRoute"},
+		// listed principals don't fall back to the default
+		{principal: "mobile-app", method: "/protos.RouteGuide/SearchFeatures"},
+		{principal: "stranger", method: "/protos.RouteGuide/SearchFeatures", want: true},
+		{principal: "stranger", method: "/protos.RouteGuide/GetFeature"},
+	}
+	for _, tt := range tests {
+		if got := policy.Allowed(&Principal{Name: tt.principal}, tt.method); got != tt.want {
+			t.Errorf("Allowed(%s, %s) = %v, want %v", tt.principal, tt.method, got, tt.want)
+		}
+	}
+	var none *Policy
+	if !none.Allowed(&Principal{Name: "anyone"}, "/protos.RouteGuide/RouteChat") {
+		t.Error("a nil policy denied a call")
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tokens := Chain{testTokens{"s3cr3t-admin": "admin", "s3cr3t-mobile": "mobile-app"}}
+	policy := &Policy{Principals: map[string][]string{"admin": {"*"}, "mobile-app": {"GetFeature"}}}
+	interceptor := UnaryServerInterceptor(tokens, policy, "/grpc.health.v1.Health/")
+	tests := []struct {
+		name          string
+		method        string
+		md            metadata.MD
+		want          codes.Code
+		wantPrincipal string
+	}{
+		{name: "admin", method: "/protos.RouteGuide/RecordRoute", md: authorization("Bearer s3cr3t-admin"), wantPrincipal: "admin"},
+		{name: "lower case scheme", method: "/protos.RouteGuide/GetFeature", md: authorization("bearer s3cr3t-mobile"), wantPrincipal: "mobile-app"},
+		{name: "no metadata", method: "/protos.RouteGuide/GetFeature", want: codes.Unauthenticated},
+		{name: "no authorization header", method: "/protos.RouteGuide/GetFeature", md: metadata.Pairs("x-other", "1"), want: codes.Unauthenticated},
+		{name: "basic auth", method: "/protos.RouteGuide/GetFeature", md: authorization("Basic YWxpY2U6czNjcjN0"), want: codes.Unauthenticated},
+		{name: "bearer without a token", method: "/protos.RouteGuide/GetFeature", md: authorization("Bearer "), want: codes.Unauthenticated},
+		{name: "token without a scheme", method: "/protos.RouteGuide/GetFeature", md: authorization("s3cr3t-admin"), want: codes.Unauthenticated},
+		{name: "unknown token", method: "/protos.RouteGuide/GetFeature", md: authorization("Bearer guess"), want: codes.Unauthenticated},
+		{name: "denied by the policy", method: "/protos.RouteGuide/RecordRoute", md: authorization("Bearer s3cr3t-mobile"), want: codes.PermissionDenied},
+		{name: "health check without credentials", method: "/grpc.health.v1.Health/Check"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+			called := false
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					called = true
+					p, ok := FromContext(ctx)
+					if tt.wantPrincipal != "" && (!ok || p.Name != tt.wantPrincipal) {
+						t.Errorf("handler saw principal %v, want %s", p, tt.wantPrincipal)
+					}
+					return nil, nil
+				})
+			if code := status.Code(err); code != tt.want {
+				t.Fatalf("interceptor = %v, want %s", err, tt.want)
+			}
+			if called != (tt.want == codes.OK) {
+				t.Errorf("handler called = %v", called)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptorSwapsContext(t *testing.T) {
+	interceptor := StreamServerInterceptor(testTokens{"s3cr3t": "alice"}, nil)
+	ctx := metadata.NewIncomingContext(context.Background(), authorization("Bearer s3cr3t"))
+	err := interceptor(nil, &fakeStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/protos.RouteGuide/RouteChat"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			if p, ok := FromContext(ss.Context()); !ok || p.Name != "alice" {
+				t.Errorf("handler saw principal %v, want alice", p)
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+	err = interceptor(nil, &fakeStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/protos.RouteGuide/RouteChat"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			t.Error("handler called without credentials")
+			return nil
+		})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("interceptor without credentials = %v, want Unauthenticated", err)
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// testTokens maps tokens to principal names
+type testTokens map[string]string
+
+func (tt testTokens) Authenticate(token string) (*Principal, error) {
+	if name, ok := tt[token]; ok {
+		return &Principal{Name: name}, nil
+	}
+	return nil, ErrInvalidToken
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func authorization(value string) metadata.MD {
+	return metadata.Pairs("authorization", value)
+}
+
+// newTestVerifier loads keys, by kid, through a JWKS file and stops its clock at now
+func newTestVerifier(t *testing.T, keys map[string]crypto.PublicKey) *JWTVerifier {
+	var set []interface{}
+	for kid, key := range keys {
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			set = append(set, map[string]interface{}{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			set = append(set, ecJWK(kid, k))
+		}
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJSON(t, path, map[string]interface{}{"keys": set})
+	v, err := LoadJWKSFile(path)
+	if err != nil {
+		t.Fatalf("LoadJWKSFile: %v", err)
+	}
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]interface{} {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return map[string]interface{}{
+		"kty": "EC",
+		"kid": kid,
+		"crv": key.Curve.Params().Name,
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+func writeJSON(t *testing.T, path string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signingInput is the header and claims segments of a token
+func signingInput(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	return encodeSegment(t, map[string]string{"alg": alg, "typ": "JWT", "kid": kid}) + "." + encodeSegment(t, claims)
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := signingInput(t, "RS256", kid, claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// signES256 signs with the fixed width r||s encoding JWS uses
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := signingInput(t, "ES256", kid, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// truncateSignature drops the last byte of the signature
+func truncateSignature(t *testing.T, token string) string {
+	i := len(token) - 1
+	for token[i] != '.' {
+		i--
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token[:i+1] + base64.RawURLEncoding.EncodeToString(sig[:len(sig)-1])
+}
+
+// swapClaims replaces the claims of a signed token, keeping its header and signature
+func swapClaims(token string, claims map[string]interface{}) string {
+	data, _ := json.Marshal(claims)
+	first, last := 0, len(token)-1
+	for token[first] != '.' {
+		first++
+	}
+	for token[last] != '.' {
+		last--
+	}
+	return token[:first+1] + base64.RawURLEncoding.EncodeToString(data) + token[last:]
+}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	// register the hashes used by the supported algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// clockSkew is how far exp and nbf may be off before a token is rejected
+const clockSkew = time.Minute
+
+// JWTVerifier authenticates JWTs signed by one of the keys of a local JWKS file.
+// Only RS256/384/512 and ES256/384/512 are accepted, the principal is the "sub" claim.
+type JWTVerifier struct {
+	// Issuer and Audience are checked against the "iss" and "aud" claims when set
+	Issuer   string
+	Audience string
+
+	keys map[string]crypto.PublicKey
+	// now is the clock exp and nbf are checked against
+	now func() time.Time
+}
+
+// LoadJWKSFile reads the verification keys from a JSON Web Key Set file.
+// Keys without a "kid" are stored under the empty kid and match tokens without one.
+func LoadJWKSFile(path string) (*JWTVerifier, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(file, &set); err != nil {
+		return nil, err
+	}
+	v := &JWTVerifier{keys: make(map[string]crypto.PublicKey), now: time.Now}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks: key %q: %v", k.Kid, err)
+		}
+		v.keys[k.Kid] = key
+	}
+	if len(v.keys) == 0 {
+		return nil, fmt.Errorf("jwks: %s holds no signing keys", path)
+	}
+	return v, nil
+}
+
+// Authenticate implements Authenticator
+func (v *JWTVerifier) Authenticate(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, ok := v.keys[header.Kid]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims struct {
+		Subject   string          `json:"sub"`
+		Issuer    string          `json:"iss"`
+		Audience  json.RawMessage `json:"aud"`
+		ExpiresAt *int64          `json:"exp"`
+		NotBefore *int64          `json:"nbf"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	now := v.now()
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(clockSkew)) {
+		return nil, ErrInvalidToken
+	}
+	if claims.NotBefore != nil && now.Before(time.Unix(*claims.NotBefore, 0).Add(-clockSkew)) {
+		return nil, ErrInvalidToken
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, ErrInvalidToken
+	}
+	if v.Audience != "" && !hasAudience(claims.Audience, v.Audience) {
+		return nil, ErrInvalidToken
+	}
+	if claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return &Principal{Name: claims.Subject}, nil
+}
+
+// ------ Unexported helpers ------ //
+
+// jwk is a single JSON Web Key, only the RSA and EC members are read
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("rsa exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifySignature checks sig over signed with key. The algorithm must match the key type,
+// so an RSA key can never be used to accept an EC signed token or the other way around.
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("alg %q does not match an RSA key", alg)
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, sig)
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("alg %q does not match an EC key", alg)
+		}
+		// JWS encodes ES signatures as the fixed width concatenation of r and s
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("bad signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("bad signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key")
+}
+
+// decodeSegment base64url decodes a JWT segment into v
+func decodeSegment(seg string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(raw) == 0 {
+		return nil, fmt.Errorf("malformed key parameter")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// hasAudience checks the "aud" claim, which may be a string or an array of strings
+func hasAudience(raw json.RawMessage, want string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == want
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err != nil {
+		return false
+	}
+	for _, aud := range many {
+		if aud == want {
+			return true
+		}
+	}
+	return false
+}
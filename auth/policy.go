@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+)
+
+// Policy maps principals to the RPCs they may call.
+// A nil Policy allows every authenticated principal to call every RPC.
+type Policy struct {
+	// Principals maps a principal name to its allowed methods. A method is either the
+	// full gRPC name ( "/protos.RouteGuide/GetFeature" ), the bare method name ( "GetFeature" ) or "*".
+	Principals map[string][]string `json:"principals"`
+	// Default applies to authenticated principals missing from Principals.
+	Default []string `json:"default"`
+}
+
+// LoadPolicyFile reads a JSON policy, e.g. a read-only mobile client:
+//
+//	{
+//	  "principals": {
+//	    "admin": ["*"],
+//	    "mobile-app": ["GetFeature", "ListFeatures", "NearestFeatures", "SearchFeatures"]
+//	  },
+//	  "default": []
+//	}
+func LoadPolicyFile(path string) (*Policy, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if err := json.Unmarshal(file, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Allowed checks if the principal may call fullMethod
+func (p *Policy) Allowed(principal *Principal, fullMethod string) bool {
+	if p == nil {
+		return true
+	}
+	methods, ok := p.Principals[principal.Name]
+	if !ok {
+		methods = p.Default
+	}
+	name := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	for _, m := range methods {
+		if m == "*" || m == fullMethod || m == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// StaticTokens authenticates tokens listed in a token file
+type StaticTokens struct {
+	// principals is keyed by the sha256 of the token so lookups don't compare raw secrets
+	principals map[[sha256.Size]byte]*Principal
+}
+
+// LoadTokenFile reads a token file. Each line holds a token and the principal it
+// authenticates as, separated by whitespace. Blank lines and lines starting with # are ignored.
+//
+//	# token        principal
+//	s3cr3t-admin   admin
+//	s3cr3t-mobile  mobile-app
+func LoadTokenFile(path string) (*StaticTokens, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tokens := &StaticTokens{principals: make(map[[sha256.Size]byte]*Principal)}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and a principal", path, line)
+		}
+		tokens.principals[sha256.Sum256([]byte(fields[0]))] = &Principal{Name: fields[1]}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Authenticate implements Authenticator
+func (t *StaticTokens) Authenticate(token string) (*Principal, error) {
+	if p, ok := t.principals[sha256.Sum256([]byte(token))]; ok {
+		return p, nil
+	}
+	return nil, ErrInvalidToken
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// Chat is an open RouteChat. Every note sent for a location is answered with the notes left there
+// that the chat wasn't sent yet, its own last, and notes others leave anywhere arrive as they are
+// left. Send may be called from several goroutines, Recv from one at a time alongside them.
+type Chat struct {
+	stream protos.RouteGuide_RouteChatClient
+	cancel context.CancelFunc
+	// sendMu serializes Send and CloseSend, the stream allows a single sender
+	sendMu sync.Mutex
+}
+
+// Chat opens a RouteChat. Close it once done, or cancel ctx, to release the call.
+func (c *Client) Chat(ctx context.Context) (*Chat, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.RouteGuideClient.RouteChat(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Chat{stream: stream, cancel: cancel}, nil
+}
+
+// Send leaves a note. An error means the chat is over, Recv returns the reason.
+func (ch *Chat) Send(note *protos.RouteNote) error {
+	ch.sendMu.Lock()
+	defer ch.sendMu.Unlock()
+	return ch.stream.Send(note)
+}
+
+// Recv returns the next note from the server, io.EOF once the server has ended the chat
+// after CloseSend.
+func (ch *Chat) Recv() (*protos.RouteNote, error) {
+	return ch.stream.Recv()
+}
+
+// CloseSend tells the server no more notes follow. Recv keeps returning notes until io.EOF.
+func (ch *Chat) CloseSend() error {
+	ch.sendMu.Lock()
+	defer ch.sendMu.Unlock()
+	return ch.stream.CloseSend()
+}
+
+// Close ends the chat right away, a blocked Recv returns with Canceled
+func (ch *Chat) Close() error {
+	ch.cancel()
+	return nil
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/protobuf/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+	"gitlab.com/ethanlewis787/fun-with-grpc/server"
+)
+
+func TestChat(t *testing.T) {
+	c := newTestClient(t, &server.RouteGuideServerImpl{RouteNotes: make(map[string][]*protos.RouteNote)})
+	chat, err := c.Chat(context.Background())
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	defer chat.Close()
+	first := &protos.RouteNote{Location: &protos.Point{Latitude: 1, Longitude: 2}, Message: "first"}
+	second := &protos.RouteNote{Location: &protos.Point{Latitude: 1, Longitude: 2}, Message: "second"}
+	for _, note := range []*protos.RouteNote{first, second} {
+		if err := chat.Send(note); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		got, err := chat.Recv()
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		if !proto.Equal(got, note) {
+			t.Errorf("Recv = %v, want %v", got, note)
+		}
+	}
+	if err := chat.CloseSend(); err != nil {
+		t.Fatalf("CloseSend: %v", err)
+	}
+	if note, err := chat.Recv(); err != io.EOF {
+		t.Errorf("Recv after CloseSend = %v, %v, want io.EOF", note, err)
+	}
+}
+
+// Close ends the chat right away, a Recv waiting for notes returns Canceled.
+func TestChatClose(t *testing.T) {
+	c := newTestClient(t, &server.RouteGuideServerImpl{RouteNotes: make(map[string][]*protos.RouteNote)})
+	chat, err := c.Chat(context.Background())
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := chat.Recv()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Recv returned %v before Close", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	chat.Close()
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.Canceled {
+			t.Errorf("Recv = %v, want Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Recv still blocked after Close")
+	}
+}
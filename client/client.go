@@ -1,25 +1,176 @@
+// Package client is a Go API for the RouteGuide service, used by fwgrpc-client and by services
+// embedding it.
 package client
 
 import (
 	"io"
 	"math/rand"
-	"sync"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 )
 
 // Client wrapper for RouteGuideClient
+// GetFeature, ListFeatures, NearestFeatures, SearchFeatures, RecordRoute and Chat return their
+// results, the Print* and Run* helpers log them through Zlogger instead.
 type Client struct {
 	RouteGuideClient protos.RouteGuideClient
 	Zlogger          *zap.Logger
+	// Retry holds the RetryPolicy of each method by RPC name, e.g. "GetFeature". Methods without
+	// one are not retried. ListFeatures resumes after the last feature returned, NearestFeatures
+	// is only retried before its first feature. RecordRoute is only retried when nothing was sent
+	// yet or its PointSource is a RewindablePointSource, the whole route is then sent again.
+	Retry map[string]RetryPolicy
+	// Hedge makes GetFeature send more attempts while the first is slow to answer, in place of
+	// its RetryPolicy. Nil disables hedging.
+	Hedge *HedgingPolicy
 }
 
-// PrintFeature - get the feature for the given point
-func (c *Client) PrintFeature(ctx context.Context, point *protos.Point) error {
-	feature, err := c.RouteGuideClient.GetFeature(ctx, point)
+// New creates a Client on conn retrying reads with DefaultRetryPolicies. logger is used by the
+// Print* and Run* helpers and to log retries, it may be nil.
+func New(conn *grpc.ClientConn, logger *zap.Logger) *Client {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Client{RouteGuideClient: protos.NewRouteGuideClient(conn), Zlogger: logger, Retry: DefaultRetryPolicies()}
+}
+
+// GetFeature returns the feature at the requested point, a feature without a name when
+// the server knows of none there.
+func (c *Client) GetFeature(ctx context.Context, req *protos.GetFeatureRequest) (*protos.Feature, error) {
+	if c.Hedge != nil && c.Hedge.MaxAttempts > 1 {
+		return c.hedgedGetFeature(ctx, req)
+	}
+	r := c.retrier(ctx, "GetFeature")
+	for {
+		feature, err := c.RouteGuideClient.GetFeature(ctx, req)
+		if err == nil || !r.retry(err) {
+			return feature, err
+		}
+	}
+}
+
+// ListFeatures returns the features matching req. The server sends at most a page of features per
+// call, the iterator keeps asking for the next page until it stops handing out page tokens, so a
+// max_results set on req bounds each page, not the total.
+func (c *Client) ListFeatures(ctx context.Context, req *protos.ListFeaturesRequest) *FeatureIterator {
+	// the page token changes from call to call, the caller's req is left as it was
+	req = proto.Clone(req).(*protos.ListFeaturesRequest)
+	return &FeatureIterator{
+		open: func(pageToken string) (featureStream, error) {
+			req.PageToken = pageToken
+			return c.RouteGuideClient.ListFeatures(ctx, req)
+		},
+		paged:     true,
+		pageToken: req.PageToken,
+		retry:     c.retrier(ctx, "ListFeatures"),
+		resume: func(last *protos.Feature) (string, bool) {
+			return resumeToken(last, req.ReadMask)
+		},
+	}
+}
+
+// NearestFeatures returns the features closest to a point, nearest first
+func (c *Client) NearestFeatures(ctx context.Context, req *protos.NearestFeaturesRequest) *FeatureIterator {
+	return &FeatureIterator{
+		open: func(string) (featureStream, error) {
+			return c.RouteGuideClient.NearestFeatures(ctx, req)
+		},
+		retry: c.retrier(ctx, "NearestFeatures"),
+	}
+}
+
+// SearchFeatures returns the features whose names match the query, best match first
+func (c *Client) SearchFeatures(ctx context.Context, req *protos.SearchRequest) ([]*protos.SearchResult, error) {
+	r := c.retrier(ctx, "SearchFeatures")
+	for {
+		resp, err := c.RouteGuideClient.SearchFeatures(ctx, req)
+		if err == nil {
+			return resp.Results, nil
+		}
+		if !r.retry(err) {
+			return nil, err
+		}
+	}
+}
+
+// RecordRoute streams the points of a route to the server and returns the RouteSummary it answers
+// with. When points fails the call is cancelled rather than finished, so the server never records
+// part of a route, and the error of points is returned.
+// A failed call is only retried under the "RecordRoute" RetryPolicy, see Client.Retry.
+func (c *Client) RecordRoute(ctx context.Context, points PointSource) (*protos.RouteSummary, error) {
+	r := c.retrier(ctx, "RecordRoute")
+	rewindable, _ := points.(RewindablePointSource)
+	for {
+		summary, sent, err := c.recordRoute(ctx, points)
+		if err, ok := err.(pointSourceError); ok {
+			return nil, err.error
+		}
+		if err == nil {
+			return summary, nil
+		}
+		if sent && rewindable == nil || !r.retry(err) {
+			return nil, err
+		}
+		if sent {
+			if err := rewindable.Rewind(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// RouteChat sends every note read from notes until it is closed, handing the notes the server
+// sends, see Chat, to received. It returns once the server has ended the chat,
+// or with the first error of received, which cancels the chat.
+func (c *Client) RouteChat(ctx context.Context, notes <-chan *protos.RouteNote, received func(*protos.RouteNote) error) error {
+	chat, err := c.Chat(ctx)
+	if err != nil {
+		return err
+	}
+	defer chat.Close()
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			in, err := chat.Recv()
+			if err == io.EOF {
+				recvErr <- nil
+				return
+			}
+			if err == nil {
+				err = received(in)
+			}
+			if err != nil {
+				recvErr <- err
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case note, ok := <-notes:
+			if !ok {
+				chat.CloseSend()
+				return <-recvErr
+			}
+			if err := chat.Send(note); err != nil {
+				// the reason comes out of Recv
+				return <-recvErr
+			}
+		case err := <-recvErr:
+			// the server ended the chat before we were done
+			return err
+		}
+	}
+}
+
+// PrintFeature - get the feature at the requested point
+func (c *Client) PrintFeature(ctx context.Context, req *protos.GetFeatureRequest) error {
+	feature, err := c.GetFeature(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -30,21 +181,24 @@ func (c *Client) PrintFeature(ctx context.Context, point *protos.Point) error {
 // PrintFeatures - get a list of features within the given bouding rectangle
 func (c *Client) PrintFeatures(ctx context.Context, rect *protos.Rectangle) error {
 	c.Zlogger.Info("Looking for features within : ", zap.Any("rect", rect))
-	stream, err := c.RouteGuideClient.ListFeatures(ctx, rect)
+	return c.printFeatures(c.ListFeatures(ctx, &protos.ListFeaturesRequest{Lo: rect.Lo, Hi: rect.Hi}))
+}
+
+// PrintNearestFeatures - get the features closest to a point, nearest first
+func (c *Client) PrintNearestFeatures(ctx context.Context, req *protos.NearestFeaturesRequest) error {
+	c.Zlogger.Info("Looking for features near : ", zap.Any("point", req.Location))
+	return c.printFeatures(c.NearestFeatures(ctx, req))
+}
+
+// PrintSearch - search feature names and log the ranked results
+func (c *Client) PrintSearch(ctx context.Context, req *protos.SearchRequest) error {
+	c.Zlogger.Info("Searching for : ", zap.String("query", req.Query))
+	results, err := c.SearchFeatures(ctx, req)
 	if err != nil {
 		return err
 	}
-	// not a big fan of this forever loop stuff wish Recv would block or return eof :/
-	for {
-		feature, err := stream.Recv()
-		// at the end
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-		c.Zlogger.Info("Found", zap.Any("feature", feature))
+	for _, result := range results {
+		c.Zlogger.Info("Found", zap.Float64("score", result.Score), zap.Any("feature", result.Feature))
 	}
 	return nil
 }
@@ -59,16 +213,7 @@ func (c *Client) RunRecordRoute(ctx context.Context) error {
 		points = append(points, randomPoint(r))
 	}
 	c.Zlogger.Info("traversing points : ", zap.Int("length", len(points)))
-	stream, err := c.RouteGuideClient.RecordRoute(ctx)
-	if err != nil {
-		return err
-	}
-	for _, point := range points {
-		if err := stream.Send(point); err != nil {
-			return err
-		}
-	}
-	reply, err := stream.CloseAndRecv()
+	reply, err := c.RecordRoute(ctx, Points(points...))
 	if err != nil {
 		return err
 	}
@@ -87,35 +232,22 @@ func (c *Client) RunRouteChat(ctx context.Context) error {
 		{&protos.Point{Latitude: 0, Longitude: 2}, "Fifth message"},
 		{&protos.Point{Latitude: 0, Longitude: 3}, "Sixth message"},
 	}
-	stream, err := c.RouteGuideClient.RouteChat(ctx)
-	if err != nil {
-		return err
-	}
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		for {
-			in, err := stream.Recv()
-			if err == io.EOF {
-				wg.Done()
-				return
-			}
-			if err != nil {
-				c.Zlogger.Error("failed to receive note :", zap.Error(err))
-			}
-			c.Zlogger.Info("Got message", zap.String("message", in.Message),
-				zap.Int32("lat", in.Location.Latitude), zap.Int32("long", in.Location.Longitude))
-		}
-	}()
+	send := make(chan *protos.RouteNote, len(notes))
 	for _, note := range notes {
 		c.Zlogger.Info("sending", zap.Any("note", note))
-		if err := stream.Send(note); err != nil {
-			return err
-		}
+		send <- note
 	}
-	stream.CloseSend()
-	wg.Wait()
-	return nil
+	close(send)
+	return c.RouteChat(ctx, send, func(in *protos.RouteNote) error {
+		// a note without a location is logged without coordinates rather than as 0,0
+		if in.GetLocation() == nil {
+			c.Zlogger.Info("Got message", zap.String("message", in.GetMessage()))
+			return nil
+		}
+		c.Zlogger.Info("Got message", zap.String("message", in.GetMessage()),
+			zap.Int32("lat", in.GetLocation().GetLatitude()), zap.Int32("long", in.GetLocation().GetLongitude()))
+		return nil
+	})
 }
 
 // ------ Unexported helpers ------ //
@@ -126,3 +258,48 @@ func randomPoint(r *rand.Rand) *protos.Point {
 	long := (r.Int31n(360) - 180) * 1e7
 	return &protos.Point{Latitude: lat, Longitude: long}
 }
+
+// pointSourceError is the error of a PointSource, never retried
+type pointSourceError struct {
+	error
+}
+
+// recordRoute makes a single RecordRoute call, sent reports whether any point was taken from points
+func (c *Client) recordRoute(ctx context.Context, points PointSource) (summary *protos.RouteSummary, sent bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.RouteGuideClient.RecordRoute(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	for {
+		point, err := points.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, sent, pointSourceError{err}
+		}
+		sent = true
+		if err := stream.Send(point); err != nil {
+			// the reason comes out of CloseAndRecv
+			break
+		}
+	}
+	summary, err = stream.CloseAndRecv()
+	return summary, sent, err
+}
+
+// printFeatures logs every feature of it
+func (c *Client) printFeatures(it *FeatureIterator) error {
+	for {
+		feature, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c.Zlogger.Info("Found", zap.Any("feature", feature))
+	}
+}
@@ -0,0 +1,235 @@
+package client
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/protobuf/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+	"gitlab.com/ethanlewis787/fun-with-grpc/server"
+)
+
+// A listing that fails part way through a page resumes after the last feature it returned and
+// follows the server's pages, without touching the caller's request.
+func TestListFeaturesResumes(t *testing.T) {
+	var features []*protos.Feature
+	for i := int32(1); i <= 5; i++ {
+		features = append(features, &protos.Feature{Name: "feature", Location: &protos.Point{Latitude: i, Longitude: i}})
+	}
+	rs := &server.RouteGuideServerImpl{MaxListResults: 2}
+	rs.SetFeatures(features)
+	c := newTestClient(t, rs, grpc.StreamInterceptor(failOnce(3)))
+
+	req := &protos.ListFeaturesRequest{
+		Lo: &protos.Point{Latitude: 0, Longitude: 0},
+		Hi: &protos.Point{Latitude: 10, Longitude: 10},
+	}
+	want := proto.Clone(req)
+	it := c.ListFeatures(context.Background(), req)
+	var got []*protos.Feature
+	for {
+		feature, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		got = append(got, feature)
+	}
+	if len(got) != len(features) {
+		t.Fatalf("got %d features, want %d: %v", len(got), len(features), got)
+	}
+	for i := range got {
+		if !proto.Equal(got[i], features[i]) {
+			t.Errorf("feature %d = %v, want %v", i, got[i], features[i])
+		}
+	}
+	if !proto.Equal(req, want) {
+		t.Errorf("ListFeatures changed the request to %v", req)
+	}
+}
+
+func TestHedgingStopsOnResourceExhausted(t *testing.T) {
+	feature := &protos.Feature{Name: "slow but fine"}
+	tests := []struct {
+		name string
+		// answers are the results of the attempts in the order they are sent, slow ones answer
+		// after 100ms
+		answers   []fakeAnswer
+		wantErr   codes.Code
+		wantCalls int
+	}{
+		{
+			name:      "first attempt pushed back",
+			answers:   []fakeAnswer{{err: codes.ResourceExhausted}, {}, {}},
+			wantErr:   codes.ResourceExhausted,
+			wantCalls: 1,
+		},
+		{
+			name:      "hedge pushed back while the first is in flight",
+			answers:   []fakeAnswer{{slow: true, feature: feature}, {err: codes.ResourceExhausted}, {}},
+			wantCalls: 2,
+		},
+		{
+			name:      "non fatal failures keep hedging",
+			answers:   []fakeAnswer{{err: codes.Unavailable}, {err: codes.Unavailable}, {feature: feature}},
+			wantCalls: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeRouteGuide{answers: tt.answers}
+			c := &Client{
+				RouteGuideClient: fake,
+				Hedge:            &HedgingPolicy{MaxAttempts: 3, Delay: 10 * time.Millisecond, NonFatalCodes: []codes.Code{codes.Unavailable}},
+			}
+			got, err := c.GetFeature(context.Background(), &protos.GetFeatureRequest{})
+			if status.Code(err) != tt.wantErr {
+				t.Fatalf("GetFeature error = %v, want %s", err, tt.wantErr)
+			}
+			if err == nil && !proto.Equal(got, feature) {
+				t.Errorf("GetFeature = %v, want %v", got, feature)
+			}
+			// give a wrongly sent attempt the chance to show up
+			time.Sleep(50 * time.Millisecond)
+			if calls := fake.callCount(); calls != tt.wantCalls {
+				t.Errorf("sent %d attempts, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRecordRoutePoints(t *testing.T) {
+	c := newTestClient(t, &server.RouteGuideServerImpl{})
+	summary, err := c.RecordRoute(context.Background(), Points(
+		&protos.Point{Latitude: 0, Longitude: 0},
+		&protos.Point{Latitude: 0, Longitude: 10000000},
+		&protos.Point{Latitude: 0, Longitude: 20000000},
+	))
+	if err != nil {
+		t.Fatalf("RecordRoute: %v", err)
+	}
+	if summary.PointCount != 3 {
+		t.Errorf("point_count = %d, want 3", summary.PointCount)
+	}
+	// two degrees of longitude on the equator are a little over 222km
+	if summary.DistanceMeters < 222e3 || summary.DistanceMeters > 223e3 {
+		t.Errorf("distance_meters = %f, want about 222km", summary.DistanceMeters)
+	}
+}
+
+// A failing PointSource abandons the route and its error is returned as is.
+func TestRecordRouteSourceError(t *testing.T) {
+	var calls int
+	source := PointSourceFunc(func() (*protos.Point, error) {
+		calls++
+		if calls == 1 {
+			return &protos.Point{Latitude: 1, Longitude: 1}, nil
+		}
+		return nil, io.ErrUnexpectedEOF
+	})
+	c := newTestClient(t, &server.RouteGuideServerImpl{})
+	if summary, err := c.RecordRoute(context.Background(), source); err != io.ErrUnexpectedEOF {
+		t.Errorf("RecordRoute = %v, %v, want io.ErrUnexpectedEOF", summary, err)
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+func newTestClient(t *testing.T, rs *server.RouteGuideServerImpl, opts ...grpc.ServerOption) *Client {
+	grpcServer := grpc.NewServer(opts...)
+	protos.RegisterRouteGuideServer(grpcServer, rs)
+	lis := bufconn.Listen(1 << 20)
+	go grpcServer.Serve(lis)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		grpcServer.Stop()
+	})
+	return New(conn, nil)
+}
+
+// failOnce fails the stream with Unavailable once it has sent n messages in total
+func failOnce(n int) grpc.StreamServerInterceptor {
+	var mu sync.Mutex
+	sent := 0
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &failingStream{ServerStream: ss, fail: func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			sent++
+			return sent == n+1
+		}})
+	}
+}
+
+type failingStream struct {
+	grpc.ServerStream
+	fail func() bool
+}
+
+func (s *failingStream) SendMsg(m interface{}) error {
+	if s.fail() {
+		return status.Errorf(codes.Unavailable, "failed for the test")
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+type fakeAnswer struct {
+	slow    bool
+	feature *protos.Feature
+	err     codes.Code
+}
+
+// fakeRouteGuide answers GetFeature attempts with answers in turn
+type fakeRouteGuide struct {
+	protos.RouteGuideClient
+	mu      sync.Mutex
+	answers []fakeAnswer
+	calls   int
+}
+
+func (f *fakeRouteGuide) GetFeature(ctx context.Context, req *protos.GetFeatureRequest, opts ...grpc.CallOption) (*protos.Feature, error) {
+	f.mu.Lock()
+	a := f.answers[f.calls]
+	f.calls++
+	f.mu.Unlock()
+	if a.slow {
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if a.err != codes.OK {
+		return nil, status.Errorf(a.err, "%s for the test", a.err)
+	}
+	return a.feature, nil
+}
+
+func (f *fakeRouteGuide) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"io"
+
+	"google.golang.org/grpc/metadata"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/pagetoken"
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// FeatureIterator walks the features sent by ListFeatures or NearestFeatures. The call is only
+// started by the first Next, cancel the context it was created with to stop early.
+type FeatureIterator struct {
+	// open starts the call for the page after pageToken, the first page when it is empty
+	open func(pageToken string) (featureStream, error)
+	// paged iterators keep calling open while the server hands out page tokens
+	paged     bool
+	pageToken string
+	stream    featureStream
+	err       error
+
+	// retry decides whether a failed call is opened again
+	retry *retrier
+	// resume returns the page token listing the features after last, nil or false when the call
+	// can't be resumed and is only retried before its first feature
+	resume func(last *protos.Feature) (string, bool)
+	// last is the last feature returned by the current call
+	last *protos.Feature
+}
+
+// Next returns the next feature, or io.EOF once every feature has been returned.
+// Any other error is the status of the failed call and is returned again by later calls.
+func (it *FeatureIterator) Next() (*protos.Feature, error) {
+	for it.err == nil {
+		if it.stream == nil {
+			stream, err := it.open(it.pageToken)
+			if err != nil {
+				if !it.reopen(err) {
+					it.err = err
+				}
+				continue
+			}
+			it.stream = stream
+		}
+		feature, err := it.stream.Recv()
+		if err == nil {
+			it.last = feature
+			return feature, nil
+		}
+		if err != io.EOF {
+			if !it.reopen(err) {
+				it.err = err
+			}
+			continue
+		}
+		// trailers are only available once Recv has returned io.EOF
+		it.pageToken = ""
+		if it.paged {
+			if vals := it.stream.Trailer().Get(pagetoken.NextPageTokenTrailer); len(vals) > 0 {
+				it.pageToken = vals[0]
+			}
+		}
+		it.stream, it.last = nil, nil
+		if it.pageToken == "" {
+			it.err = io.EOF
+		}
+	}
+	return nil, it.err
+}
+
+// ------ Unexported helpers ------ //
+
+// reopen reports whether the call that failed with err is to be opened again and moves the page
+// token past the features already returned
+func (it *FeatureIterator) reopen(err error) bool {
+	if it.retry == nil {
+		return false
+	}
+	token := it.pageToken
+	if it.last != nil {
+		if it.resume == nil {
+			return false
+		}
+		var ok bool
+		if token, ok = it.resume(it.last); !ok {
+			return false
+		}
+		// a call that made progress gets all its attempts again
+		it.retry.reset()
+	}
+	if !it.retry.retry(err) {
+		return false
+	}
+	it.pageToken, it.stream, it.last = token, nil, nil
+	return true
+}
+
+// featureStream is the receiving side shared by the ListFeatures and NearestFeatures clients
+type featureStream interface {
+	Recv() (*protos.Feature, error)
+	Trailer() metadata.MD
+}
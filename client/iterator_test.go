@@ -0,0 +1,90 @@
+package client
+
+import (
+	"io"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+	"gitlab.com/ethanlewis787/fun-with-grpc/server"
+)
+
+// Next hands out every feature and then io.EOF, for good.
+func TestFeatureIteratorEnds(t *testing.T) {
+	rs := &server.RouteGuideServerImpl{MaxListResults: 2}
+	rs.SetFeatures([]*protos.Feature{
+		{Name: "one", Location: &protos.Point{Latitude: 1, Longitude: 1}},
+		{Name: "two", Location: &protos.Point{Latitude: 2, Longitude: 2}},
+		{Name: "three", Location: &protos.Point{Latitude: 3, Longitude: 3}},
+	})
+	c := newTestClient(t, rs)
+	ctx := context.Background()
+	tests := map[string]struct {
+		it   *FeatureIterator
+		want []string
+	}{
+		// three features take two pages
+		"ListFeatures": {
+			it: c.ListFeatures(ctx, &protos.ListFeaturesRequest{
+				Lo: &protos.Point{Latitude: 0, Longitude: 0},
+				Hi: &protos.Point{Latitude: 10, Longitude: 10},
+			}),
+			want: []string{"one", "two", "three"},
+		},
+		"ListFeatures without matches": {
+			it: c.ListFeatures(ctx, &protos.ListFeaturesRequest{
+				Lo: &protos.Point{Latitude: 20, Longitude: 20},
+				Hi: &protos.Point{Latitude: 30, Longitude: 30},
+			}),
+		},
+		"NearestFeatures": {
+			it:   c.NearestFeatures(ctx, &protos.NearestFeaturesRequest{Location: &protos.Point{Latitude: 3, Longitude: 3}}),
+			want: []string{"three", "two"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			for {
+				feature, err := tt.it.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next: %v", err)
+				}
+				got = append(got, feature.Name)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %q, want %q", got, tt.want)
+				}
+			}
+			if feature, err := tt.it.Next(); err != io.EOF {
+				t.Errorf("Next after the end = %v, %v, want io.EOF", feature, err)
+			}
+		})
+	}
+}
+
+// A failed call's status is returned by every later Next.
+func TestFeatureIteratorError(t *testing.T) {
+	c := newTestClient(t, &server.RouteGuideServerImpl{})
+	it := c.ListFeatures(context.Background(), &protos.ListFeaturesRequest{
+		Lo:        &protos.Point{Latitude: 0, Longitude: 0},
+		Hi:        &protos.Point{Latitude: 10, Longitude: 10},
+		PageToken: "not a token",
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := it.Next(); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Next = %v, want InvalidArgument", err)
+		}
+	}
+}
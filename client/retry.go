@@ -0,0 +1,216 @@
+package client
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/pagetoken"
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// RetryPolicy says which failures of a method are tried again and how long to wait in between.
+// The wait starts at InitialBackoff and grows by Multiplier after every attempt up to MaxBackoff,
+// each wait is randomized by Jitter so clients that failed together don't retry together.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, 0 or 1 never retries
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction a wait may be shortened or lengthened by, between 0 and 1
+	Jitter float64
+	// RetryableCodes are the status codes worth trying again, any other failure is returned as is
+	RetryableCodes []codes.Code
+}
+
+// HedgingPolicy sends GetFeature again when an attempt is slow to answer, the first answer wins
+// and the other attempts are cancelled. No more attempts are sent once one fails with
+// ResourceExhausted, the server is then shedding load.
+type HedgingPolicy struct {
+	// MaxAttempts bounds the attempts of a call, the first included
+	MaxAttempts int
+	// Delay is how long an attempt may go unanswered before the next one is sent
+	Delay time.Duration
+	// NonFatalCodes end an attempt without failing the call, the next attempt is sent right away
+	NonFatalCodes []codes.Code
+}
+
+// DefaultRetryPolicy retries Unavailable up to three times, waiting about 100ms, 200ms then 400ms
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+	RetryableCodes: []codes.Code{codes.Unavailable},
+}
+
+// DefaultRetryPolicies retries the reads, which are safe to send more than once. RecordRoute is
+// left out on purpose, see Client.Retry.
+func DefaultRetryPolicies() map[string]RetryPolicy {
+	return map[string]RetryPolicy{
+		"GetFeature":      DefaultRetryPolicy,
+		"ListFeatures":    DefaultRetryPolicy,
+		"NearestFeatures": DefaultRetryPolicy,
+		"SearchFeatures":  DefaultRetryPolicy,
+	}
+}
+
+// RewindablePointSource is a PointSource that can start the route over. RecordRoute only
+// retries a route that was partly sent when its source is one, Points is.
+type RewindablePointSource interface {
+	PointSource
+	// Rewind makes Next return the first point again
+	Rewind() error
+}
+
+// ------ Unexported helpers ------ //
+
+// retrier counts the attempts of one call
+type retrier struct {
+	ctx     context.Context
+	logger  *zap.Logger
+	method  string
+	policy  RetryPolicy
+	attempt int
+}
+
+func (c *Client) retrier(ctx context.Context, method string) *retrier {
+	return &retrier{ctx: ctx, logger: c.Zlogger, method: method, policy: c.Retry[method], attempt: 1}
+}
+
+// retry reports whether a call that failed with err should be made again, after waiting out the
+// backoff. It gives up once the attempts are used up, err is not retryable or ctx is done.
+func (r *retrier) retry(err error) bool {
+	if r.attempt >= r.policy.MaxAttempts || !hasCode(r.policy.RetryableCodes, err) {
+		return false
+	}
+	wait := r.backoff()
+	if deadline, ok := r.ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		// the next attempt could only fail with DeadlineExceeded
+		return false
+	}
+	if r.logger != nil {
+		r.logger.Warn("retrying", zap.String("method", r.method), zap.Int("attempt", r.attempt+1),
+			zap.Duration("backoff", wait), zap.Error(err))
+	}
+	select {
+	case <-time.After(wait):
+	case <-r.ctx.Done():
+		return false
+	}
+	r.attempt++
+	return true
+}
+
+// reset starts counting attempts over, for calls that made progress since they last failed
+func (r *retrier) reset() {
+	r.attempt = 1
+}
+
+// backoff is the wait before the next attempt, InitialBackoff*Multiplier^(attempt-1) capped at
+// MaxBackoff, give or take Jitter
+func (r *retrier) backoff() time.Duration {
+	p := r.policy
+	wait := float64(p.InitialBackoff) * math.Pow(math.Max(p.Multiplier, 1), float64(r.attempt-1))
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		wait *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(wait)
+}
+
+// hedgedGetFeature runs GetFeature under c.Hedge
+func (c *Client) hedgedGetFeature(ctx context.Context, req *protos.GetFeatureRequest) (*protos.Feature, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// cancels the attempts still in flight once one has answered
+	defer cancel()
+	type answer struct {
+		feature *protos.Feature
+		err     error
+	}
+	policy := c.Hedge
+	answers := make(chan answer, policy.MaxAttempts)
+	sent, pending := 0, 0
+	// throttled stops sending attempts once the server answered ResourceExhausted
+	throttled := false
+	var hedge <-chan time.Time
+	send := func() {
+		sent++
+		pending++
+		if sent > 1 && c.Zlogger != nil {
+			c.Zlogger.Debug("hedging", zap.String("method", "GetFeature"), zap.Int("attempt", sent))
+		}
+		go func() {
+			feature, err := c.RouteGuideClient.GetFeature(ctx, req)
+			answers <- answer{feature, err}
+		}()
+		hedge = nil
+		if sent < policy.MaxAttempts {
+			hedge = time.After(policy.Delay)
+		}
+	}
+	send()
+	for {
+		// an attempt is always in flight here, a cancelled ctx ends them all with Canceled
+		select {
+		case a := <-answers:
+			pending--
+			if a.err == nil {
+				return a.feature, nil
+			}
+			if status.Code(a.err) == codes.ResourceExhausted {
+				// the server is pushing back, more attempts would only add to its load. The ones
+				// in flight may still answer.
+				throttled = true
+				hedge = nil
+			} else if !hasCode(policy.NonFatalCodes, a.err) {
+				return nil, a.err
+			}
+			if !throttled && sent < policy.MaxAttempts {
+				send()
+			} else if pending == 0 {
+				return nil, a.err
+			}
+		case <-hedge:
+			send()
+		}
+	}
+}
+
+// resumeToken is the page token that lists the features after feature, the same the server puts in
+// its next-page-token trailer. The server orders features by location then name, so both have to
+// be in mask for the token to be known.
+func resumeToken(feature *protos.Feature, mask *field_mask.FieldMask) (string, bool) {
+	if len(mask.GetPaths()) > 0 {
+		paths := make(map[string]bool)
+		for _, path := range mask.GetPaths() {
+			paths[path] = true
+		}
+		hasLocation := paths["location"] || paths["location.latitude"] && paths["location.longitude"]
+		if !paths["name"] || !hasLocation {
+			return "", false
+		}
+	}
+	return pagetoken.Encode(pagetoken.Of(feature)), true
+}
+
+// hasCode reports whether err is a status carrying one of the codes in list
+func hasCode(list []codes.Code, err error) bool {
+	code := status.Code(err)
+	for _, c := range list {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// testPolicy retries Unavailable three times without waiting long
+var testPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	Multiplier:     2,
+	RetryableCodes: []codes.Code{codes.Unavailable},
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// failures are the codes the attempts fail with in turn, the attempts after them succeed
+		failures  []codes.Code
+		wantErr   codes.Code
+		wantCalls int
+	}{
+		{name: "success", wantCalls: 1},
+		{name: "invalid argument", failures: []codes.Code{codes.InvalidArgument}, wantErr: codes.InvalidArgument, wantCalls: 1},
+		{name: "permission denied", failures: []codes.Code{codes.PermissionDenied}, wantErr: codes.PermissionDenied, wantCalls: 1},
+		{name: "unavailable once", failures: []codes.Code{codes.Unavailable}, wantCalls: 2},
+		{
+			name:      "unavailable then invalid argument",
+			failures:  []codes.Code{codes.Unavailable, codes.InvalidArgument},
+			wantErr:   codes.InvalidArgument,
+			wantCalls: 2,
+		},
+		{
+			name:      "attempts used up",
+			failures:  []codes.Code{codes.Unavailable, codes.Unavailable, codes.Unavailable, codes.Unavailable},
+			wantErr:   codes.Unavailable,
+			wantCalls: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := map[string]func(c *Client) error{
+				"GetFeature": func(c *Client) error {
+					_, err := c.GetFeature(context.Background(), &protos.GetFeatureRequest{})
+					return err
+				},
+				"SearchFeatures": func(c *Client) error {
+					_, err := c.SearchFeatures(context.Background(), &protos.SearchRequest{Query: "mendham"})
+					return err
+				},
+			}
+			for method, call := range calls {
+				fake := &flakyRouteGuide{failures: tt.failures}
+				c := &Client{RouteGuideClient: fake, Retry: map[string]RetryPolicy{method: testPolicy}}
+				if err := call(c); status.Code(err) != tt.wantErr {
+					t.Errorf("%s = %v, want %s", method, err, tt.wantErr)
+				}
+				if calls := fake.callCount(); calls != tt.wantCalls {
+					t.Errorf("%s made %d attempts, want %d", method, calls, tt.wantCalls)
+				}
+			}
+		})
+	}
+}
+
+// Methods without a RetryPolicy are tried once.
+func TestRetryWithoutPolicy(t *testing.T) {
+	fake := &flakyRouteGuide{failures: []codes.Code{codes.Unavailable}}
+	c := &Client{RouteGuideClient: fake, Retry: map[string]RetryPolicy{"SearchFeatures": testPolicy}}
+	if _, err := c.GetFeature(context.Background(), &protos.GetFeatureRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("GetFeature = %v, want Unavailable", err)
+	}
+	if calls := fake.callCount(); calls != 1 {
+		t.Errorf("made %d attempts, want 1", calls)
+	}
+}
+
+// A route is only sent again when its source can start over or nothing of it was sent yet.
+func TestRecordRouteRetry(t *testing.T) {
+	route := []*protos.Point{{Latitude: 1, Longitude: 1}, {Latitude: 2, Longitude: 2}}
+	tests := []struct {
+		name   string
+		source func() PointSource
+		// openFails fails opening the stream instead of finishing it
+		openFails bool
+		wantErr   codes.Code
+		wantCalls int
+	}{
+		{name: "rewindable", source: func() PointSource { return Points(route...) }, wantCalls: 2},
+		{name: "not rewindable", source: func() PointSource { return onlyNext(Points(route...)) }, wantErr: codes.Unavailable, wantCalls: 1},
+		{
+			name:      "not rewindable, nothing sent",
+			source:    func() PointSource { return onlyNext(Points(route...)) },
+			openFails: true,
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &flakyRouteGuide{failures: []codes.Code{codes.Unavailable}, openFails: tt.openFails}
+			c := &Client{RouteGuideClient: fake, Retry: map[string]RetryPolicy{"RecordRoute": testPolicy}}
+			summary, err := c.RecordRoute(context.Background(), tt.source())
+			if status.Code(err) != tt.wantErr {
+				t.Fatalf("RecordRoute = %v, want %s", err, tt.wantErr)
+			}
+			if calls := fake.callCount(); calls != tt.wantCalls {
+				t.Errorf("made %d attempts, want %d", calls, tt.wantCalls)
+			}
+			if err == nil && summary.PointCount != int32(len(route)) {
+				t.Errorf("the last attempt sent %d points, want the whole route of %d", summary.PointCount, len(route))
+			}
+		})
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// flakyRouteGuide fails the first attempts with failures, the others succeed
+type flakyRouteGuide struct {
+	protos.RouteGuideClient
+	failures []codes.Code
+	// openFails makes RecordRoute fail when opened rather than on CloseAndRecv
+	openFails bool
+
+	mu    sync.Mutex
+	calls int
+}
+
+// attempt counts an attempt and returns its error
+func (f *flakyRouteGuide) attempt() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls > len(f.failures) || f.failures[f.calls-1] == codes.OK {
+		return nil
+	}
+	return status.Errorf(f.failures[f.calls-1], "attempt %d failed for the test", f.calls)
+}
+
+func (f *flakyRouteGuide) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *flakyRouteGuide) GetFeature(ctx context.Context, req *protos.GetFeatureRequest, opts ...grpc.CallOption) (*protos.Feature, error) {
+	if err := f.attempt(); err != nil {
+		return nil, err
+	}
+	return &protos.Feature{}, nil
+}
+
+func (f *flakyRouteGuide) SearchFeatures(ctx context.Context, req *protos.SearchRequest, opts ...grpc.CallOption) (*protos.SearchResponse, error) {
+	if err := f.attempt(); err != nil {
+		return nil, err
+	}
+	return &protos.SearchResponse{}, nil
+}
+
+func (f *flakyRouteGuide) RecordRoute(ctx context.Context, opts ...grpc.CallOption) (protos.RouteGuide_RecordRouteClient, error) {
+	if f.openFails {
+		if err := f.attempt(); err != nil {
+			return nil, err
+		}
+		return &recordStream{}, nil
+	}
+	return &recordStream{closeAndRecv: f.attempt}, nil
+}
+
+// recordStream counts the points sent and answers with their count
+type recordStream struct {
+	grpc.ClientStream
+	points       int32
+	closeAndRecv func() error
+}
+
+func (s *recordStream) Send(*protos.Point) error {
+	s.points++
+	return nil
+}
+
+func (s *recordStream) CloseAndRecv() (*protos.RouteSummary, error) {
+	if s.closeAndRecv != nil {
+		if err := s.closeAndRecv(); err != nil {
+			return nil, err
+		}
+	}
+	return &protos.RouteSummary{PointCount: s.points}, nil
+}
+
+// onlyNext hides every method of source but Next, e.g. Rewind
+func onlyNext(source PointSource) PointSource {
+	return PointSourceFunc(source.Next)
+}
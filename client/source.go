@@ -0,0 +1,47 @@
+package client
+
+import (
+	"io"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// PointSource hands out the points of a route to RecordRoute one at a time, so a route can be
+// streamed from a file or a GPS receiver without holding all of it in memory.
+type PointSource interface {
+	// Next returns the next point, or io.EOF after the last one. Any other error abandons the route.
+	Next() (*protos.Point, error)
+}
+
+// PointSourceFunc adapts a function to PointSource
+type PointSourceFunc func() (*protos.Point, error)
+
+// Next calls f
+func (f PointSourceFunc) Next() (*protos.Point, error) {
+	return f()
+}
+
+// Points is a RewindablePointSource over a route already in memory
+func Points(points ...*protos.Point) PointSource {
+	return &pointSlice{points: points}
+}
+
+// ------ Unexported helpers ------ //
+
+type pointSlice struct {
+	points []*protos.Point
+	next   int
+}
+
+func (s *pointSlice) Next() (*protos.Point, error) {
+	if s.next == len(s.points) {
+		return nil, io.EOF
+	}
+	s.next++
+	return s.points[s.next-1], nil
+}
+
+func (s *pointSlice) Rewind() error {
+	s.next = 0
+	return nil
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/genproto/protobuf/field_mask"
+
+	"go.uber.org/zap"
+
+	"github.com/urfave/cli"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/client"
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// getCommand looks up the feature at a point
+func getCommand(appConfig *config) cli.Command {
+	var lat, lng float64
+	var fields string
+	return cli.Command{
+		Name:         "get",
+		Usage:        "get the feature at a point, e.g. get --lat 40.9146138 --lng -74.6188906",
+		OnUsageError: onUsageError,
+		Flags: []cli.Flag{
+			cli.Float64Flag{Name: "lat", Usage: "latitude in decimal degrees", Destination: &lat},
+			cli.Float64Flag{Name: "lng", Usage: "longitude in decimal degrees", Destination: &lng},
+			fieldsFlag(&fields),
+		},
+		Action: func(cliCTX *cli.Context) error {
+			if !cliCTX.IsSet("lat") || !cliCTX.IsSet("lng") {
+				return usageErrorf("get: --lat and --lng are required")
+			}
+			point, err := pointFromDegrees(lat, lng)
+			if err != nil {
+				return usageErrorf("get: %v", err)
+			}
+			return withClient(appConfig, func(c *client.Client) error {
+				feature, err := c.GetFeature(context.Background(), &protos.GetFeatureRequest{
+					Latitude:  point.Latitude,
+					Longitude: point.Longitude,
+					ReadMask:  readMask(fields),
+				})
+				if err != nil {
+					return err
+				}
+				p := newPrinter(appConfig.output, os.Stdout)
+				p.single = true
+				if err := p.print(featureResult(feature)); err != nil {
+					return err
+				}
+				return p.flush()
+			})
+		},
+	}
+}
+
+// listCommand lists the features within a bounding box, following the server's pages
+func listCommand(appConfig *config) cli.Command {
+	var bbox, category, fields string
+	var maxResults int
+	tags := &cli.StringSlice{}
+	return cli.Command{
+		Name:         "list",
+		Usage:        "list the features within a box, e.g. list --bbox 40,-75,42,-73",
+		OnUsageError: onUsageError,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "bbox",
+				Usage:       "two opposite corners as lat1,lng1,lat2,lng2 in decimal degrees",
+				Destination: &bbox,
+			},
+			cli.IntFlag{
+				Name:        "max-results",
+				Usage:       "features per page, 0 for as many as the server allows",
+				Destination: &maxResults,
+			},
+			cli.StringSliceFlag{Name: "tag", Usage: "only features with this tag, may be repeated", Value: tags},
+			cli.StringFlag{Name: "category", Usage: "only features in this category", Destination: &category},
+			fieldsFlag(&fields),
+		},
+		Action: func(cliCTX *cli.Context) error {
+			if bbox == "" {
+				return usageErrorf("list: --bbox is required")
+			}
+			rect, err := parseBBox(bbox)
+			if err != nil {
+				return usageErrorf("list: --bbox: %v", err)
+			}
+			return withClient(appConfig, func(c *client.Client) error {
+				return printFeatures(appConfig, c.ListFeatures(context.Background(), &protos.ListFeaturesRequest{
+					Lo:         rect.Lo,
+					Hi:         rect.Hi,
+					MaxResults: int32(maxResults),
+					ReadMask:   readMask(fields),
+					Filter:     featureFilter(*tags, category),
+				}))
+			})
+		},
+	}
+}
+
+// nearestCommand lists the features closest to a point, nearest first
+func nearestCommand(appConfig *config) cli.Command {
+	var lat, lng, maxDistance float64
+	var category, fields string
+	var maxResults int
+	tags := &cli.StringSlice{}
+	return cli.Command{
+		Name:         "nearest",
+		Usage:        "list the features nearest to a point, e.g. nearest --lat 40.9146138 --lng -74.6188906 --max-results 3",
+		OnUsageError: onUsageError,
+		Flags: []cli.Flag{
+			cli.Float64Flag{Name: "lat", Usage: "latitude in decimal degrees", Destination: &lat},
+			cli.Float64Flag{Name: "lng", Usage: "longitude in decimal degrees", Destination: &lng},
+			cli.IntFlag{
+				Name:        "max-results",
+				Usage:       "number of features, 0 for the server's default",
+				Destination: &maxResults,
+			},
+			cli.Float64Flag{
+				Name:        "max-distance",
+				Usage:       "only features within this many meters, 0 for any distance",
+				Destination: &maxDistance,
+			},
+			cli.StringSliceFlag{Name: "tag", Usage: "only features with this tag, may be repeated", Value: tags},
+			cli.StringFlag{Name: "category", Usage: "only features in this category", Destination: &category},
+			fieldsFlag(&fields),
+		},
+		Action: func(cliCTX *cli.Context) error {
+			if !cliCTX.IsSet("lat") || !cliCTX.IsSet("lng") {
+				return usageErrorf("nearest: --lat and --lng are required")
+			}
+			point, err := pointFromDegrees(lat, lng)
+			if err != nil {
+				return usageErrorf("nearest: %v", err)
+			}
+			return withClient(appConfig, func(c *client.Client) error {
+				return printFeatures(appConfig, c.NearestFeatures(context.Background(), &protos.NearestFeaturesRequest{
+					Location:          point,
+					MaxResults:        int32(maxResults),
+					MaxDistanceMeters: maxDistance,
+					ReadMask:          readMask(fields),
+					Filter:            featureFilter(*tags, category),
+				}))
+			})
+		},
+	}
+}
+
+// searchCommand looks for features by name, best match first
+func searchCommand(appConfig *config) cli.Command {
+	var bbox string
+	var maxResults int
+	return cli.Command{
+		Name:         "search",
+		Usage:        "search features by name, e.g. search --max-results 5 mendham nj",
+		ArgsUsage:    "<query>",
+		OnUsageError: onUsageError,
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:        "max-results",
+				Usage:       "number of matches, 0 for the server's default",
+				Destination: &maxResults,
+			},
+			cli.StringFlag{
+				Name:        "bbox",
+				Usage:       "only features within two opposite corners as lat1,lng1,lat2,lng2",
+				Destination: &bbox,
+			},
+		},
+		Action: func(cliCTX *cli.Context) error {
+			query := strings.TrimSpace(strings.Join(cliCTX.Args(), " "))
+			if query == "" {
+				return usageErrorf("search: a query is required")
+			}
+			req := &protos.SearchRequest{Query: query, MaxResults: int32(maxResults)}
+			if bbox != "" {
+				rect, err := parseBBox(bbox)
+				if err != nil {
+					return usageErrorf("search: --bbox: %v", err)
+				}
+				req.Bounds = rect
+			}
+			return withClient(appConfig, func(c *client.Client) error {
+				results, err := c.SearchFeatures(context.Background(), req)
+				if err != nil {
+					return err
+				}
+				p := newPrinter(appConfig.output, os.Stdout)
+				for _, sr := range results {
+					if err := p.print(searchResult(sr)); err != nil {
+						return err
+					}
+				}
+				return p.flush()
+			})
+		},
+	}
+}
+
+// recordCommand sends a route read from a GPX or CSV file and prints the summary
+func recordCommand(appConfig *config) cli.Command {
+	var from, format string
+	return cli.Command{
+		Name:         "record",
+		Usage:        "record a route from a GPX or CSV file, e.g. record --from ride.gpx",
+		OnUsageError: onUsageError,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "from",
+				Usage:       "GPX or CSV (lat,lng per row) file of the route, - for stdin",
+				Destination: &from,
+			},
+			cli.StringFlag{
+				Name:        "format",
+				Usage:       "gpx or csv, defaults to the file extension and is required with --from -",
+				Destination: &format,
+			},
+		},
+		Action: func(cliCTX *cli.Context) error {
+			if from == "" {
+				return usageErrorf("record: --from is required")
+			}
+			points, err := readPoints(from, strings.ToLower(format))
+			if err != nil {
+				return fmt.Errorf("record: %v", err)
+			}
+			return withClient(appConfig, func(c *client.Client) error {
+				summary, err := c.RecordRoute(context.Background(), client.Points(points...))
+				if err != nil {
+					return err
+				}
+				p := newPrinter(appConfig.output, os.Stdout)
+				p.single = true
+				if err := p.print(summaryResult(summary, points)); err != nil {
+					return err
+				}
+				return p.flush()
+			})
+		},
+	}
+}
+
+// chatCommand sends a RouteNote for every "lat,lng message" line on stdin and prints the notes
+// the server sends back as they arrive, until stdin is closed. With --interactive it is a
+// terminal chat room instead, see repl.
+func chatCommand(appConfig *config) cli.Command {
+	var interactive bool
+	var lat, lng float64
+	return cli.Command{
+		Name:         "chat",
+		Usage:        "chat about locations, one \"lat,lng message\" line per note on stdin, or interactively with -i",
+		OnUsageError: onUsageError,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:        "interactive, i",
+				Usage:       "chat from a prompt with /move, /history and /quit, reconnecting when the connection drops",
+				Destination: &interactive,
+			},
+			cli.Float64Flag{Name: "lat", Usage: "starting latitude in decimal degrees, for --interactive", Destination: &lat},
+			cli.Float64Flag{Name: "lng", Usage: "starting longitude in decimal degrees, for --interactive", Destination: &lng},
+		},
+		Action: func(cliCTX *cli.Context) error {
+			if !interactive {
+				return withClient(appConfig, func(c *client.Client) error {
+					return chatLines(appConfig, c)
+				})
+			}
+			var start *protos.Point
+			if cliCTX.IsSet("lat") || cliCTX.IsSet("lng") {
+				var err error
+				if start, err = pointFromDegrees(lat, lng); err != nil {
+					return usageErrorf("chat: %v", err)
+				}
+			}
+			return withClient(appConfig, func(c *client.Client) error {
+				r := newREPL(c, os.Stdin, os.Stdout)
+				r.prompt = isTerminal(os.Stdin)
+				r.location = start
+				return r.run(context.Background())
+			})
+		},
+	}
+}
+
+// demoCommand runs the original walk through every RPC against canned data
+func demoCommand(appConfig *config) cli.Command {
+	return cli.Command{
+		Name:  "demo",
+		Usage: "call every RPC once with canned data",
+		Action: func(cliCTX *cli.Context) error {
+			return withClient(appConfig, func(routeClient *client.Client) error {
+				zlogger := routeClient.Zlogger
+
+				// looking for valid
+				err := routeClient.PrintFeature(context.Background(), &protos.GetFeatureRequest{Latitude: 409146138, Longitude: -746188906})
+				if err != nil {
+					zlogger.Error("got", zap.Error(err))
+				}
+				// looking for missing
+				err = routeClient.PrintFeature(context.Background(), &protos.GetFeatureRequest{Latitude: 0, Longitude: 0})
+				if err != nil {
+					zlogger.Error("got", zap.Error(err))
+				}
+
+				err = routeClient.PrintFeatures(context.Background(), &protos.Rectangle{
+					Lo: &protos.Point{Latitude: 400000000, Longitude: -750000000},
+					Hi: &protos.Point{Latitude: 420000000, Longitude: -730000000},
+				})
+				if err != nil {
+					zlogger.Error("got", zap.Error(err))
+				}
+
+				// only ask for the names of the three closest features
+				err = routeClient.PrintNearestFeatures(context.Background(), &protos.NearestFeaturesRequest{
+					Location:   &protos.Point{Latitude: 409146138, Longitude: -746188906},
+					MaxResults: 3,
+					ReadMask:   &field_mask.FieldMask{Paths: []string{"name"}},
+				})
+				if err != nil {
+					zlogger.Error("got", zap.Error(err))
+				}
+
+				// fuzzy search, "mendam" should still find Mendham
+				err = routeClient.PrintSearch(context.Background(), &protos.SearchRequest{Query: "mendam nj", MaxResults: 5})
+				if err != nil {
+					zlogger.Error("got", zap.Error(err))
+				}
+
+				err = routeClient.RunRecordRoute(context.Background())
+				if err != nil {
+					zlogger.Error("got", zap.Error(err))
+				}
+
+				err = routeClient.RunRouteChat(context.Background())
+				if err != nil {
+					zlogger.Error("got", zap.Error(err))
+				}
+				return nil
+			})
+		},
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// printFeatures prints every feature of it as it arrives, as far as the output format allows
+func printFeatures(appConfig *config, it *client.FeatureIterator) error {
+	p := newPrinter(appConfig.output, os.Stdout)
+	for {
+		feature, err := it.Next()
+		if err == io.EOF {
+			return p.flush()
+		}
+		if err != nil {
+			// whatever arrived before the failure is still printed
+			p.flush()
+			return err
+		}
+		if err := p.print(featureResult(feature)); err != nil {
+			return err
+		}
+	}
+}
+
+// withClient dials the server, hands a Client to fn and closes the connection afterwards
+func withClient(appConfig *config, fn func(*client.Client) error) error {
+	conn, err := dial(appConfig)
+	if err != nil {
+		appConfig.logger.Error("fail to dial :", zap.Error(err))
+		return err
+	}
+	defer conn.Close()
+	c := client.New(conn, appConfig.logger)
+	c.Retry = appConfig.retryPolicies()
+	c.Hedge = appConfig.hedgingPolicy()
+	return fn(c)
+}
+
+func fieldsFlag(fields *string) cli.Flag {
+	return cli.StringFlag{
+		Name:        "fields",
+		Usage:       "comma separated feature fields to return, e.g. name,location, all when empty",
+		Destination: fields,
+	}
+}
+
+// readMask turns --fields name,location into a FieldMask, nil when fields is empty
+func readMask(fields string) *field_mask.FieldMask {
+	if fields == "" {
+		return nil
+	}
+	return &field_mask.FieldMask{Paths: strings.Split(fields, ",")}
+}
+
+// featureFilter is nil unless a tag or category was given
+func featureFilter(tags []string, category string) *protos.FeatureFilter {
+	if len(tags) == 0 && category == "" {
+		return nil
+	}
+	return &protos.FeatureFilter{Tags: tags, Category: category}
+}
+
+// chatLines runs the non interactive chat, notes come from stdin and are printed in the output format
+func chatLines(appConfig *config, c *client.Client) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notes := make(chan *protos.RouteNote)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(notes)
+		readErr <- readNotes(ctx, bufio.NewScanner(os.Stdin), notes)
+	}()
+	p := newPrinter(appConfig.output, os.Stdout)
+	p.live = true
+	err := c.RouteChat(ctx, notes, func(note *protos.RouteNote) error {
+		return p.print(noteResult(note))
+	})
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+	// a bad line closes notes early, the reader is done by then
+	select {
+	case err := <-readErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// readNotes parses "lat,lng message" lines into notes until the scanner runs out or ctx is done.
+// Blank lines are skipped.
+func readNotes(ctx context.Context, scanner *bufio.Scanner, notes chan<- *protos.RouteNote) error {
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 2)
+		point, err := parsePoint(fields[0])
+		if err != nil {
+			return fmt.Errorf("chat: line %d: %v", line, err)
+		}
+		note := &protos.RouteNote{Location: point}
+		if len(fields) == 2 {
+			note.Message = strings.TrimSpace(fields[1])
+		}
+		select {
+		case notes <- note:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return scanner.Err()
+}
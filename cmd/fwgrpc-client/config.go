@@ -1,5 +1,183 @@
 package main
 
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/codes"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/client"
+)
+
+// minKeepaliveTime is the shortest keepalive interval grpc clients use
+const minKeepaliveTime = 10 * time.Second
+
 type config struct {
+	// configFile is layered under the flags and environment variables, see configfile.Load
+	configFile     string
 	gRPCServerAddr string
+	// output is the format results are printed in, one of outputFormats
+	output string
+	// TLS is used when useTLS or tlsCA is set, tlsCert and tlsKey are the client certificate for mutual TLS
+	useTLS        bool
+	tlsCA         string
+	tlsCert       string
+	tlsKey        string
+	tlsServerName string
+	// token is sent as a bearer token on every RPC when set
+	token              string
+	allowInsecureToken bool
+	// keepalive pings, off when keepaliveTime is 0
+	keepaliveTime                time.Duration
+	keepaliveTimeout             time.Duration
+	keepalivePermitWithoutStream bool
+	// message size limits in bytes
+	maxRecvMsgSize int
+	maxSendMsgSize int
+	// retries of the reads, see client.RetryPolicy, off when retryMaxAttempts is 1
+	retryMaxAttempts    int
+	retryInitialBackoff time.Duration
+	retryMaxBackoff     time.Duration
+	retryJitter         float64
+	retryCodes          string
+	// retryRecord also retries record, sending the whole route again
+	retryRecord bool
+	// hedging of get, off when hedgeDelay is 0
+	hedgeDelay       time.Duration
+	hedgeMaxAttempts int
+	// tracing exporter settings, see tracing.Options
+	traceExporter string
+	traceFile     string
+	otlpEndpoint  string
+	otlpInsecure  bool
+	// logging settings, see logging.Options
+	logLevel    string
+	logFormat   string
+	logSampling bool
+	logOutput   string
+	// logger is built from the logging settings before any command runs
+	logger *zap.Logger
+}
+
+// validate checks the merged flags, environment variables and settings file before any command runs
+func (c *config) validate() error {
+	// unix:///path/to.sock is understood by grpc.Dial as is
+	if !strings.HasPrefix(c.gRPCServerAddr, "unix://") {
+		if _, _, err := net.SplitHostPort(c.gRPCServerAddr); err != nil {
+			return fmt.Errorf("server-address: %v", err)
+		}
+	}
+	if (c.tlsCert == "") != (c.tlsKey == "") {
+		return fmt.Errorf("tls-cert and tls-key must be set together")
+	}
+	if c.tlsCert != "" && !c.useTLS && c.tlsCA == "" {
+		return fmt.Errorf("tls-cert: a client certificate needs tls or tls-ca")
+	}
+	if err := validOutput(c.output); err != nil {
+		return fmt.Errorf("output: %v", err)
+	}
+	// grpc raises shorter intervals to 10s anyway, and the server disconnects clients pinging too often
+	if c.keepaliveTime != 0 && c.keepaliveTime < minKeepaliveTime {
+		return fmt.Errorf("keepalive-time: must be 0 or at least %s", minKeepaliveTime)
+	}
+	if c.keepaliveTimeout <= 0 {
+		return fmt.Errorf("keepalive-timeout: must be positive")
+	}
+	if c.maxRecvMsgSize <= 0 || c.maxSendMsgSize <= 0 {
+		return fmt.Errorf("max-recv-msg-size and max-send-msg-size must be positive")
+	}
+	if c.retryMaxAttempts < 1 {
+		return fmt.Errorf("retry-max-attempts: must be at least 1")
+	}
+	if c.retryInitialBackoff <= 0 || c.retryMaxBackoff < c.retryInitialBackoff {
+		return fmt.Errorf("retry-initial-backoff must be positive and no longer than retry-max-backoff")
+	}
+	if c.retryJitter < 0 || c.retryJitter > 1 {
+		return fmt.Errorf("retry-jitter: must be between 0 and 1")
+	}
+	if _, err := parseCodes(c.retryCodes); err != nil {
+		return fmt.Errorf("retry-codes: %v", err)
+	}
+	if c.hedgeDelay < 0 {
+		return fmt.Errorf("hedge-delay: must not be negative")
+	}
+	if c.hedgeDelay > 0 && c.hedgeMaxAttempts < 2 {
+		return fmt.Errorf("hedge-max-attempts: must be at least 2 to hedge")
+	}
+	switch c.traceExporter {
+	case "stdout", "file", "otlp", "none":
+	default:
+		return fmt.Errorf("trace-exporter: %q is not stdout, file, otlp or none", c.traceExporter)
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.logLevel)); err != nil {
+		return fmt.Errorf("log-level: %q is not debug, info, warn or error", c.logLevel)
+	}
+	if c.logFormat != "json" && c.logFormat != "console" {
+		return fmt.Errorf("log-format: %q is not json or console", c.logFormat)
+	}
+	return nil
+}
+
+// retryPolicies are the client.RetryPolicy of every method the retry flags apply to
+func (c *config) retryPolicies() map[string]client.RetryPolicy {
+	retryCodes, _ := parseCodes(c.retryCodes)
+	policy := client.RetryPolicy{
+		MaxAttempts:    c.retryMaxAttempts,
+		InitialBackoff: c.retryInitialBackoff,
+		MaxBackoff:     c.retryMaxBackoff,
+		Multiplier:     2,
+		Jitter:         c.retryJitter,
+		RetryableCodes: retryCodes,
+	}
+	policies := make(map[string]client.RetryPolicy)
+	for method := range client.DefaultRetryPolicies() {
+		policies[method] = policy
+	}
+	if c.retryRecord {
+		policies["RecordRoute"] = policy
+	}
+	return policies
+}
+
+// hedgingPolicy is the client.HedgingPolicy of get, nil when hedging is off. Attempts failing
+// with one of retry-codes make way for the next one.
+func (c *config) hedgingPolicy() *client.HedgingPolicy {
+	if c.hedgeDelay == 0 {
+		return nil
+	}
+	retryCodes, _ := parseCodes(c.retryCodes)
+	return &client.HedgingPolicy{
+		MaxAttempts:   c.hedgeMaxAttempts,
+		Delay:         c.hedgeDelay,
+		NonFatalCodes: retryCodes,
+	}
+}
+
+// parseCodes parses a comma separated list of status codes, named like unavailable,
+// Unavailable or UNAVAILABLE, underscores optional
+func parseCodes(list string) ([]codes.Code, error) {
+	var parsed []codes.Code
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.Replace(strings.TrimSpace(name), "_", "", -1))
+		if name == "" {
+			continue
+		}
+		found := false
+		for code := codes.OK; code <= codes.Unauthenticated; code++ {
+			if strings.ToLower(code.String()) == name {
+				parsed = append(parsed, code)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%q is not a status code", name)
+		}
+	}
+	return parsed, nil
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/client"
+	"gitlab.com/ethanlewis787/fun-with-grpc/logging"
+	"gitlab.com/ethanlewis787/fun-with-grpc/tlsconfig"
+	"gitlab.com/ethanlewis787/fun-with-grpc/tracing"
+)
+
+// dial connects to the server using the transport and auth flags
+func dial(appConfig *config) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{
+		tracing.DialOption(),
+		grpc.WithUnaryInterceptor(logging.UnaryClientInterceptor(appConfig.logger)),
+		grpc.WithStreamInterceptor(logging.StreamClientInterceptor(appConfig.logger)),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(appConfig.maxRecvMsgSize),
+			grpc.MaxCallSendMsgSize(appConfig.maxSendMsgSize),
+		),
+	}
+	// pings keep a quiet RouteChat alive through NATs and surface a dead server as an error
+	// on the open streams instead of a hang
+	if appConfig.keepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                appConfig.keepaliveTime,
+			Timeout:             appConfig.keepaliveTimeout,
+			PermitWithoutStream: appConfig.keepalivePermitWithoutStream,
+		}))
+	}
+	if appConfig.useTLS || appConfig.tlsCA != "" {
+		tlsConfig, err := tlsconfig.NewClientConfig(tlsconfig.ClientOptions{
+			CAFile:     appConfig.tlsCA,
+			CertFile:   appConfig.tlsCert,
+			KeyFile:    appConfig.tlsKey,
+			ServerName: appConfig.tlsServerName,
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if appConfig.token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(client.TokenCredentials{
+			Token:         appConfig.token,
+			AllowInsecure: appConfig.allowInsecureToken,
+		}))
+	}
+	return grpc.Dial(appConfig.gRPCServerAddr, opts...)
+}
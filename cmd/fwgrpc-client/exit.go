@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/urfave/cli"
+)
+
+// Exit codes of the RPC commands. A failed RPC exits with exitRPCBase plus its gRPC code,
+// e.g. 69 for NotFound or 78 for Unavailable, the convention grpcurl uses as well.
+const (
+	exitError   = 1
+	exitUsage   = 2
+	exitRPCBase = 64
+)
+
+// exitCodesHelp is shown in the app's help text
+const exitCodesHelp = `Exit codes:
+   0      success
+   1      any other failure, e.g. an unreadable route file
+   2      bad or missing flags
+   64+N   the RPC failed with gRPC code N, e.g. 69 NotFound, 78 Unavailable, 80 Unauthenticated`
+
+// usageError is a bad or missing flag
+type usageError struct {
+	error
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+// onUsageError makes flag parsing failures exit with exitUsage
+func onUsageError(cliCTX *cli.Context, err error, isSubcommand bool) error {
+	return usageError{err}
+}
+
+// exitCode picks the exit code for an error returned by a command, 0 for none
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if _, ok := err.(usageError); ok {
+		return exitUsage
+	}
+	if st, ok := status.FromError(err); ok && st.Code() != codes.OK {
+		return exitRPCBase + int(st.Code())
+	}
+	return exitError
+}
+
+// errorMessage is err as shown on stderr, RPC failures as "NotFound: message"
+func errorMessage(err error) string {
+	if st, ok := status.FromError(err); ok {
+		return fmt.Sprintf("%s: %s", st.Code(), st.Message())
+	}
+	return err.Error()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "success", err: nil, want: 0},
+		{name: "other failure", err: errors.New("walk.gpx: no points"), want: exitError},
+		{name: "usage", err: usageErrorf("missing --point"), want: exitUsage},
+		{name: "Canceled", err: status.Error(codes.Canceled, "canceled"), want: 65},
+		{name: "InvalidArgument", err: status.Error(codes.InvalidArgument, "bad mask"), want: 67},
+		{name: "NotFound", err: status.Error(codes.NotFound, "no feature"), want: 69},
+		{name: "ResourceExhausted", err: status.Error(codes.ResourceExhausted, "slow down"), want: 72},
+		{name: "Unavailable", err: status.Error(codes.Unavailable, "draining"), want: 78},
+		{name: "Unauthenticated", err: status.Error(codes.Unauthenticated, "no token"), want: 80},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: status.Error(codes.NotFound, "no feature at 1,2"), want: "NotFound: no feature at 1,2"},
+		{err: fmt.Errorf("walk.gpx: no points"), want: "walk.gpx: no points"},
+	}
+	for _, tt := range tests {
+		if got := errorMessage(tt.err); got != tt.want {
+			t.Errorf("errorMessage(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
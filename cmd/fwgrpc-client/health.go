@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/urfave/cli"
+)
+
+// healthCommand asks the server's grpc.health.v1 service for its status and exits
+// non-zero unless it is SERVING, so it can be used as a container health check. A server
+// that is up but not serving exits with 78, the code for Unavailable.
+func healthCommand(appConfig *config) cli.Command {
+	var service string
+	var timeout time.Duration
+	return cli.Command{
+		Name:         "health",
+		Usage:        "check the server's health, exits non-zero when it is not serving",
+		OnUsageError: onUsageError,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "service",
+				Value:       "", // default value, the server as a whole
+				Usage:       "service to check, e.g. protos.RouteGuide",
+				Destination: &service,
+			},
+			cli.DurationFlag{
+				Name:        "timeout",
+				Value:       5 * time.Second, // default value
+				Usage:       "how long to wait for an answer",
+				Destination: &timeout,
+			},
+		},
+		Action: func(cliCTX *cli.Context) error {
+			conn, err := dial(appConfig)
+			if err != nil {
+				return fmt.Errorf("fail to dial: %v", err)
+			}
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+			if err != nil {
+				return err
+			}
+			p := newPrinter(appConfig.output, os.Stdout)
+			p.single = true
+			if err := p.print(healthResult(service, resp)); err != nil {
+				return err
+			}
+			if err := p.flush(); err != nil {
+				return err
+			}
+			// exits with exitRPCBase plus Unavailable, like a server that can't be reached
+			if resp.Status != healthpb.HealthCheckResponse_SERVING {
+				return status.Errorf(codes.Unavailable, "%s", resp.Status)
+			}
+			return nil
+		},
+	}
+}
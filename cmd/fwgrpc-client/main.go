@@ -1,17 +1,15 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"os"
+	"time"
 
 	"golang.org/x/net/context"
 
-	"gitlab.com/ethanlewis787/fun-with-grpc/client"
-	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
-
-	"google.golang.org/grpc"
-
-	"go.uber.org/zap"
+	"gitlab.com/ethanlewis787/fun-with-grpc/configfile"
+	"gitlab.com/ethanlewis787/fun-with-grpc/logging"
+	"gitlab.com/ethanlewis787/fun-with-grpc/tracing"
 
 	"github.com/urfave/cli"
 )
@@ -23,73 +21,265 @@ func main() {
 	app.Name = "fun-with-grpc-client"
 	app.Usage = "cli used to interact with a gRPC client"
 	app.Version = "v0.0.0" // major,minor,patch
+	app.Description = "Results are printed on stdout, logs and errors on stderr.\n\n" + exitCodesHelp
+	app.OnUsageError = onUsageError
 	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:        configfile.FlagName,
+			Usage:       "YAML or TOML settings file, flags and environment variables take precedence over it",
+			EnvVar:      "CONFIG",
+			Destination: &appConfig.configFile,
+		},
 		cli.StringFlag{
 			Name:        "server-address",
 			Value:       "127.0.0.1:10101", // default value
-			Usage:       "gRPC server address and port",
+			Usage:       "gRPC server address and port, or unix:///path for a Unix socket",
 			EnvVar:      "SERVER_ADDRESS",
 			Destination: &appConfig.gRPCServerAddr,
 		},
+		cli.StringFlag{
+			Name:        "output, o",
+			Value:       "table", // default value
+			Usage:       "result format: table, json, ndjson, csv or geojson",
+			EnvVar:      "OUTPUT",
+			Destination: &appConfig.output,
+		},
+		cli.BoolFlag{
+			Name:        "tls",
+			Usage:       "connect over TLS, verifying the server against the system roots unless tls-ca is set",
+			EnvVar:      "TLS",
+			Destination: &appConfig.useTLS,
+		},
+		cli.StringFlag{
+			Name:        "tls-ca",
+			Usage:       "PEM bundle of CAs trusted to sign the server certificate, implies --tls",
+			EnvVar:      "TLS_CA",
+			Destination: &appConfig.tlsCA,
+		},
+		cli.StringFlag{
+			Name:        "tls-cert",
+			Usage:       "PEM client certificate for mutual TLS",
+			EnvVar:      "TLS_CERT",
+			Destination: &appConfig.tlsCert,
+		},
+		cli.StringFlag{
+			Name:        "tls-key",
+			Usage:       "PEM client private key for mutual TLS",
+			EnvVar:      "TLS_KEY",
+			Destination: &appConfig.tlsKey,
+		},
+		cli.StringFlag{
+			Name:        "tls-server-name",
+			Usage:       "override the server name checked against the server certificate",
+			EnvVar:      "TLS_SERVER_NAME",
+			Destination: &appConfig.tlsServerName,
+		},
+		cli.StringFlag{
+			Name:        "token",
+			Usage:       "bearer token sent with every RPC",
+			EnvVar:      "TOKEN",
+			Destination: &appConfig.token,
+		},
+		cli.BoolFlag{
+			Name:        "allow-insecure-token",
+			Usage:       "allow the bearer token to be sent without TLS, for local testing only",
+			EnvVar:      "ALLOW_INSECURE_TOKEN",
+			Destination: &appConfig.allowInsecureToken,
+		},
+		cli.DurationFlag{
+			Name:        "keepalive-time",
+			Value:       30 * time.Second, // default value
+			Usage:       "ping the server after this long without activity, at least 10s and no shorter than the server's keepalive-min-time, 0 to disable",
+			EnvVar:      "KEEPALIVE_TIME",
+			Destination: &appConfig.keepaliveTime,
+		},
+		cli.DurationFlag{
+			Name:        "keepalive-timeout",
+			Value:       10 * time.Second, // default value
+			Usage:       "close the connection when a keepalive ping is not answered within this long",
+			EnvVar:      "KEEPALIVE_TIMEOUT",
+			Destination: &appConfig.keepaliveTimeout,
+		},
+		cli.BoolFlag{
+			Name:        "keepalive-permit-without-stream",
+			Usage:       "also ping when no call is open, the server must allow it with the same flag",
+			EnvVar:      "KEEPALIVE_PERMIT_WITHOUT_STREAM",
+			Destination: &appConfig.keepalivePermitWithoutStream,
+		},
+		cli.IntFlag{
+			Name:        "max-recv-msg-size",
+			Value:       4 << 20, // default value
+			Usage:       "largest message in bytes the client accepts",
+			EnvVar:      "MAX_RECV_MSG_SIZE",
+			Destination: &appConfig.maxRecvMsgSize,
+		},
+		cli.IntFlag{
+			Name:        "max-send-msg-size",
+			Value:       4 << 20, // default value
+			Usage:       "largest message in bytes the client sends",
+			EnvVar:      "MAX_SEND_MSG_SIZE",
+			Destination: &appConfig.maxSendMsgSize,
+		},
+		cli.IntFlag{
+			Name:        "retry-max-attempts",
+			Value:       4, // default value
+			Usage:       "most attempts of a read failing with one of retry-codes, the first included, 1 to disable retries",
+			EnvVar:      "RETRY_MAX_ATTEMPTS",
+			Destination: &appConfig.retryMaxAttempts,
+		},
+		cli.DurationFlag{
+			Name:        "retry-initial-backoff",
+			Value:       100 * time.Millisecond, // default value
+			Usage:       "wait before the first retry, doubled after every attempt",
+			EnvVar:      "RETRY_INITIAL_BACKOFF",
+			Destination: &appConfig.retryInitialBackoff,
+		},
+		cli.DurationFlag{
+			Name:        "retry-max-backoff",
+			Value:       5 * time.Second, // default value
+			Usage:       "longest wait between retries",
+			EnvVar:      "RETRY_MAX_BACKOFF",
+			Destination: &appConfig.retryMaxBackoff,
+		},
+		cli.Float64Flag{
+			Name:        "retry-jitter",
+			Value:       0.2, // default value
+			Usage:       "fraction every wait is randomly shortened or lengthened by, between 0 and 1",
+			EnvVar:      "RETRY_JITTER",
+			Destination: &appConfig.retryJitter,
+		},
+		cli.StringFlag{
+			Name:        "retry-codes",
+			Value:       "unavailable", // default value
+			Usage:       "comma separated status codes a read is retried on, e.g. unavailable,resource_exhausted",
+			EnvVar:      "RETRY_CODES",
+			Destination: &appConfig.retryCodes,
+		},
+		cli.BoolFlag{
+			Name:        "retry-record",
+			Usage:       "also retry record, sending the whole route again, the server may then see it more than once",
+			EnvVar:      "RETRY_RECORD",
+			Destination: &appConfig.retryRecord,
+		},
+		cli.DurationFlag{
+			Name:        "hedge-delay",
+			Usage:       "send get again when it is not answered within this long, the first answer wins, 0 to disable",
+			EnvVar:      "HEDGE_DELAY",
+			Destination: &appConfig.hedgeDelay,
+		},
+		cli.IntFlag{
+			Name:        "hedge-max-attempts",
+			Value:       2, // default value
+			Usage:       "most get requests hedge-delay sends, the first included",
+			EnvVar:      "HEDGE_MAX_ATTEMPTS",
+			Destination: &appConfig.hedgeMaxAttempts,
+		},
+		cli.StringFlag{
+			Name:        "trace-exporter",
+			Value:       "none", // default value, stdout would mix spans into the printed results
+			Usage:       "where to export trace spans: stdout, file, otlp or none",
+			EnvVar:      "TRACE_EXPORTER",
+			Destination: &appConfig.traceExporter,
+		},
+		cli.StringFlag{
+			Name:        "trace-file",
+			Value:       "./fwgrpc-client-traces.json", // default value
+			Usage:       "file the file trace exporter appends spans to",
+			EnvVar:      "TRACE_FILE",
+			Destination: &appConfig.traceFile,
+		},
+		cli.StringFlag{
+			Name:        "otlp-endpoint",
+			Value:       "localhost:4317", // default value
+			Usage:       "OTLP/gRPC collector address for the otlp trace exporter",
+			EnvVar:      "OTLP_ENDPOINT",
+			Destination: &appConfig.otlpEndpoint,
+		},
+		cli.BoolFlag{
+			Name:        "otlp-insecure",
+			Usage:       "send spans to the OTLP collector without TLS",
+			EnvVar:      "OTLP_INSECURE",
+			Destination: &appConfig.otlpInsecure,
+		},
+		cli.StringFlag{
+			Name:        "log-level",
+			Value:       "info", // default value
+			Usage:       "minimum level logged: debug, info, warn or error",
+			EnvVar:      "LOG_LEVEL",
+			Destination: &appConfig.logLevel,
+		},
+		cli.StringFlag{
+			Name:        "log-format",
+			Value:       "console", // default value
+			Usage:       "log encoding: json or console",
+			EnvVar:      "LOG_FORMAT",
+			Destination: &appConfig.logFormat,
+		},
+		cli.BoolFlag{
+			Name:        "log-sampling",
+			Usage:       "sample repeated log messages under load",
+			EnvVar:      "LOG_SAMPLING",
+			Destination: &appConfig.logSampling,
+		},
+		cli.StringFlag{
+			Name:        "log-output",
+			Value:       "stderr", // default value
+			Usage:       "where logs are written: stdout, stderr or a file path",
+			EnvVar:      "LOG_OUTPUT",
+			Destination: &appConfig.logOutput,
+		},
 	} // defined in flags.go
-	// ------- Main Application function -------
-	app.Action = func(cliCTX *cli.Context) error {
-		// Init zap logger
-		zlogger, err := zap.NewDevelopment() // TODO this needs to be configured for production
-		if err != nil {
-			return err
-		}
-
-		var opts []grpc.DialOption
-		opts = append(opts, grpc.WithInsecure())
-
-		conn, err := grpc.Dial(appConfig.gRPCServerAddr, opts...)
-		if err != nil {
-			zlogger.Error("fail to dial :", zap.Error(err))
+	// logging and tracing are set up before any command runs and flushed after it returns
+	var shutdownTracing func(context.Context) error
+	app.Before = func(cliCTX *cli.Context) error {
+		if err := configfile.Load(cliCTX); err != nil {
 			return err
 		}
-		defer conn.Close()
-
-		grpcClient := protos.NewRouteGuideClient(conn)
-
-		routeClient := &client.Client{
-			RouteGuideClient: grpcClient,
-			Zlogger:          zlogger,
-		}
-
-		// looking for valid
-		err = routeClient.PrintFeature(context.Background(), &protos.Point{Latitude: 409146138, Longitude: -746188906})
-		if err != nil {
-			zlogger.Error("got", zap.Error(err))
+		if err := appConfig.validate(); err != nil {
+			return usageError{err}
 		}
-		// looking for missing
-		err = routeClient.PrintFeature(context.Background(), &protos.Point{Latitude: 0, Longitude: 0})
-		if err != nil {
-			zlogger.Error("got", zap.Error(err))
-		}
-
-		err = routeClient.PrintFeatures(context.Background(), &protos.Rectangle{
-			Lo: &protos.Point{Latitude: 400000000, Longitude: -750000000},
-			Hi: &protos.Point{Latitude: 420000000, Longitude: -730000000},
+		var err error
+		appConfig.logger, err = logging.New(logging.Options{
+			Level:      appConfig.logLevel,
+			Format:     appConfig.logFormat,
+			Sampling:   appConfig.logSampling,
+			OutputPath: appConfig.logOutput,
 		})
 		if err != nil {
-			zlogger.Error("got", zap.Error(err))
+			return err
 		}
-
-		err = routeClient.RunRecordRoute(context.Background())
-		if err != nil {
-			zlogger.Error("got", zap.Error(err))
+		shutdownTracing, err = tracing.Setup(context.Background(), tracing.Options{
+			ServiceName:  app.Name,
+			Exporter:     appConfig.traceExporter,
+			FilePath:     appConfig.traceFile,
+			OTLPEndpoint: appConfig.otlpEndpoint,
+			OTLPInsecure: appConfig.otlpInsecure,
+		})
+		return err
+	}
+	app.After = func(cliCTX *cli.Context) error {
+		if appConfig.logger != nil {
+			defer appConfig.logger.Sync()
 		}
-
-		err = routeClient.RunRouteChat(context.Background())
-		if err != nil {
-			zlogger.Error("got", zap.Error(err))
+		if shutdownTracing == nil {
+			return nil
 		}
-
-		return nil
+		return shutdownTracing(context.Background())
+	}
+	app.Commands = []cli.Command{
+		getCommand(appConfig),
+		listCommand(appConfig),
+		nearestCommand(appConfig),
+		searchCommand(appConfig),
+		recordCommand(appConfig),
+		chatCommand(appConfig),
+		demoCommand(appConfig),
+		healthCommand(appConfig),
+		configfile.Command("token"),
 	}
 	// Start main
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		fmt.Fprintf(os.Stderr, "%s: %s\n", app.Name, errorMessage(err))
+		os.Exit(exitCode(err))
 	}
 }
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// outputFormats are the values of the output flag
+var outputFormats = []string{"table", "json", "ndjson", "csv", "geojson"}
+
+// result is one printable result, a feature, a note or a route summary
+type result struct {
+	// msg is written by json and ndjson
+	msg proto.Message
+	// columns and values are the csv and table row
+	columns []string
+	values  []string
+	// geometry and properties make up the GeoJSON feature, geometry is nil without a location
+	geometry   map[string]interface{}
+	properties map[string]interface{}
+}
+
+// printer writes results in the format chosen with the output flag. ndjson, csv and live tables
+// are written as results come in, json and geojson only once flush is called.
+type printer struct {
+	format string
+	w      io.Writer
+	// single results are printed on their own by json and geojson instead of in a list
+	single bool
+	// live tables are flushed after every row, at the cost of their alignment
+	live bool
+
+	collected []result
+	table     *tabwriter.Writer
+	csv       *csv.Writer
+	header    bool
+}
+
+func newPrinter(format string, w io.Writer) *printer {
+	p := &printer{format: format, w: w}
+	switch format {
+	case "table":
+		p.table = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	case "csv":
+		p.csv = csv.NewWriter(w)
+	}
+	return p
+}
+
+// print writes or collects a single result
+func (p *printer) print(r result) error {
+	switch p.format {
+	case "ndjson":
+		line, err := marshalJSON(r.msg)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.w, "%s\n", line)
+		return err
+	case "csv":
+		if !p.header {
+			p.csv.Write(r.columns)
+			p.header = true
+		}
+		p.csv.Write(r.values)
+		p.csv.Flush()
+		return p.csv.Error()
+	case "table":
+		if !p.header {
+			fmt.Fprintln(p.table, strings.ToUpper(strings.Join(r.columns, "\t")))
+			p.header = true
+		}
+		fmt.Fprintln(p.table, strings.Join(r.values, "\t"))
+		if p.live {
+			return p.table.Flush()
+		}
+		return nil
+	}
+	p.collected = append(p.collected, r)
+	return nil
+}
+
+// flush writes whatever print has held back, call it once all results are in
+func (p *printer) flush() error {
+	switch p.format {
+	case "table":
+		return p.table.Flush()
+	case "json":
+		msgs := make([]json.RawMessage, len(p.collected))
+		for i, r := range p.collected {
+			raw, err := marshalJSON(r.msg)
+			if err != nil {
+				return err
+			}
+			msgs[i] = raw
+		}
+		if p.single && len(msgs) == 1 {
+			return writeIndented(p.w, msgs[0])
+		}
+		return writeIndented(p.w, msgs)
+	case "geojson":
+		features := make([]interface{}, len(p.collected))
+		for i, r := range p.collected {
+			features[i] = map[string]interface{}{
+				"type":       "Feature",
+				"geometry":   r.geometry,
+				"properties": r.properties,
+			}
+		}
+		if p.single && len(features) == 1 {
+			return writeIndented(p.w, features[0])
+		}
+		return writeIndented(p.w, map[string]interface{}{"type": "FeatureCollection", "features": features})
+	}
+	return nil
+}
+
+// featureResult lays a feature out as name, location, category, tags and properties. csv and table
+// put the feature's own properties in one column as key=value pairs, see formatProperties.
+func featureResult(feature *protos.Feature) result {
+	r := result{
+		msg:     feature,
+		columns: []string{"name", "latitude", "longitude", "category", "tags", "properties"},
+		properties: map[string]interface{}{
+			"name": feature.Name,
+		},
+	}
+	lat, lng := degrees(feature.Location)
+	r.values = []string{feature.Name, lat, lng, feature.Category, strings.Join(feature.Tags, ";"), formatProperties(feature.Properties)}
+	if feature.Location != nil {
+		r.geometry = pointGeometry(feature.Location)
+	}
+	if feature.Category != "" {
+		r.properties["category"] = feature.Category
+	}
+	if len(feature.Tags) > 0 {
+		r.properties["tags"] = feature.Tags
+	}
+	for k, v := range feature.Properties {
+		if _, taken := r.properties[k]; !taken {
+			r.properties[k] = v
+		}
+	}
+	return r
+}
+
+// searchResult is a feature with the score it was ranked by in front
+func searchResult(sr *protos.SearchResult) result {
+	feature := sr.Feature
+	if feature == nil {
+		feature = &protos.Feature{}
+	}
+	r := featureResult(feature)
+	score := strconv.FormatFloat(sr.Score, 'f', 3, 64)
+	r.msg = sr
+	r.columns = append([]string{"score"}, r.columns...)
+	r.values = append([]string{score}, r.values...)
+	r.properties["score"] = sr.Score
+	return r
+}
+
+// summaryResult is a recorded route, geojson draws it as a line through points
+func summaryResult(summary *protos.RouteSummary, points []*protos.Point) result {
+	r := result{
+		msg:     summary,
+		columns: []string{"point_count", "feature_count", "distance_meters", "elapsed_time"},
+		values: []string{
+			strconv.Itoa(int(summary.PointCount)),
+			strconv.Itoa(int(summary.FeatureCount)),
+			strconv.FormatFloat(summary.DistanceMeters, 'f', 1, 64),
+			strconv.Itoa(int(summary.ElapsedTime)),
+		},
+		properties: map[string]interface{}{
+			"point_count":     summary.PointCount,
+			"feature_count":   summary.FeatureCount,
+			"distance_meters": summary.DistanceMeters,
+			"elapsed_time":    summary.ElapsedTime,
+		},
+	}
+	coordinates := make([][]float64, len(points))
+	for i, point := range points {
+		coordinates[i] = []float64{float64(point.Longitude) / e7, float64(point.Latitude) / e7}
+	}
+	r.geometry = map[string]interface{}{"type": "LineString", "coordinates": coordinates}
+	return r
+}
+
+// noteResult is a RouteNote received in a chat
+func noteResult(note *protos.RouteNote) result {
+	lat, lng := degrees(note.Location)
+	r := result{
+		msg:        note,
+		columns:    []string{"latitude", "longitude", "message"},
+		values:     []string{lat, lng, note.Message},
+		properties: map[string]interface{}{"message": note.Message},
+	}
+	if note.Location != nil {
+		r.geometry = pointGeometry(note.Location)
+	}
+	return r
+}
+
+// healthResult is the status of service, the server as a whole when service is empty
+func healthResult(service string, resp *healthpb.HealthCheckResponse) result {
+	return result{
+		msg:        resp,
+		columns:    []string{"service", "status"},
+		values:     []string{service, resp.Status.String()},
+		properties: map[string]interface{}{"service": service, "status": resp.Status.String()},
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// degrees formats a point's E7 coordinates as decimal degrees, empty for a missing point
+func degrees(point *protos.Point) (string, string) {
+	if point == nil {
+		return "", ""
+	}
+	return strconv.FormatFloat(float64(point.Latitude)/e7, 'f', -1, 64),
+		strconv.FormatFloat(float64(point.Longitude)/e7, 'f', -1, 64)
+}
+
+// formatProperties joins properties as key=value pairs sorted by key, separated by ";" like tags
+func formatProperties(properties map[string]string) string {
+	keys := make([]string, 0, len(properties))
+	for k := range properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + properties[k]
+	}
+	return strings.Join(pairs, ";")
+}
+
+// pointGeometry is a GeoJSON point, longitude first
+func pointGeometry(point *protos.Point) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "Point",
+		"coordinates": []float64{float64(point.Longitude) / e7, float64(point.Latitude) / e7},
+	}
+}
+
+// marshalJSON uses the protobuf JSON mapping, the same the REST gateway speaks
+func marshalJSON(msg proto.Message) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	marshaler := jsonpb.Marshaler{}
+	if err := marshaler.Marshal(&buf, msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeIndented(w io.Writer, v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", out)
+	return err
+}
+
+// validOutput checks the output flag
+func validOutput(format string) error {
+	for _, f := range outputFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not one of %s", format, strings.Join(outputFormats, ", "))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+func TestFormatProperties(t *testing.T) {
+	tests := []struct {
+		properties map[string]string
+		want       string
+	}{
+		{properties: nil, want: ""},
+		{properties: map[string]string{"surface": "gravel"}, want: "surface=gravel"},
+		{properties: map[string]string{"surface": "gravel", "opening_hours": "24/7", "fee": ""}, want: "fee=;opening_hours=24/7;surface=gravel"},
+	}
+	for _, tt := range tests {
+		if got := formatProperties(tt.properties); got != tt.want {
+			t.Errorf("formatProperties(%v) = %q, want %q", tt.properties, got, tt.want)
+		}
+	}
+}
+
+// csv and table carry the feature's properties in a column of their own.
+func TestFeaturePropertiesColumn(t *testing.T) {
+	feature := &protos.Feature{
+		Name:       "Patriots Path",
+		Location:   &protos.Point{Latitude: 407838351, Longitude: -746143763},
+		Category:   "park",
+		Tags:       []string{"trail", "dogs-allowed"},
+		Properties: map[string]string{"surface": "gravel", "opening_hours": "Mo-Fr 09:00-17:00"},
+	}
+	tests := map[string]string{
+		"csv": "name,latitude,longitude,category,tags,properties\n" +
+			"Patriots Path,40.7838351,-74.6143763,park,trail;dogs-allowed,opening_hours=Mo-Fr 09:00-17:00;surface=gravel\n",
+		"table": "NAME           LATITUDE    LONGITUDE    CATEGORY  TAGS                PROPERTIES\n" +
+			"Patriots Path  40.7838351  -74.6143763  park      trail;dogs-allowed  opening_hours=Mo-Fr 09:00-17:00;surface=gravel\n",
+	}
+	for format, want := range tests {
+		var buf bytes.Buffer
+		p := newPrinter(format, &buf)
+		if err := p.print(featureResult(feature)); err != nil {
+			t.Fatalf("%s: print: %v", format, err)
+		}
+		if err := p.flush(); err != nil {
+			t.Fatalf("%s: flush: %v", format, err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("%s output:\n%s\nwant:\n%s", format, got, want)
+		}
+	}
+}
+
+// A feature read with a mask prints its unset fields as empty columns, and GeoJSON leaves out
+// the properties and, without a location, the geometry.
+func TestMaskedFeatureOutput(t *testing.T) {
+	located := &protos.Feature{
+		Name:     "Patriots Path",
+		Location: &protos.Point{Latitude: 407838351, Longitude: -746143763},
+	}
+	named := &protos.Feature{Name: "Patriots Path"}
+	tests := []struct {
+		format  string
+		feature *protos.Feature
+		want    string
+	}{
+		{
+			format:  "table",
+			feature: located,
+			want: "NAME           LATITUDE    LONGITUDE    CATEGORY  TAGS  PROPERTIES\n" +
+				"Patriots Path  40.7838351  -74.6143763                  \n",
+		},
+		{
+			format:  "json",
+			feature: located,
+			want: `{
+  "name": "Patriots Path",
+  "location": {
+    "latitude": 407838351,
+    "longitude": -746143763
+  }
+}
+`,
+		},
+		{
+			format:  "ndjson",
+			feature: located,
+			want:    `{"name":"Patriots Path","location":{"latitude":407838351,"longitude":-746143763}}` + "\n",
+		},
+		{
+			format:  "csv",
+			feature: located,
+			want:    "name,latitude,longitude,category,tags,properties\nPatriots Path,40.7838351,-74.6143763,,,\n",
+		},
+		{
+			format:  "geojson",
+			feature: located,
+			want: `{
+  "geometry": {
+    "coordinates": [
+      -74.6143763,
+      40.7838351
+    ],
+    "type": "Point"
+  },
+  "properties": {
+    "name": "Patriots Path"
+  },
+  "type": "Feature"
+}
+`,
+		},
+		{
+			format:  "csv",
+			feature: named,
+			want:    "name,latitude,longitude,category,tags,properties\nPatriots Path,,,,,\n",
+		},
+		{
+			format:  "ndjson",
+			feature: named,
+			want:    `{"name":"Patriots Path"}` + "\n",
+		},
+		{
+			format:  "geojson",
+			feature: named,
+			want: `{
+  "geometry": null,
+  "properties": {
+    "name": "Patriots Path"
+  },
+  "type": "Feature"
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		p := newPrinter(tt.format, &buf)
+		p.single = true
+		if err := p.print(featureResult(tt.feature)); err != nil {
+			t.Fatalf("%s: print: %v", tt.format, err)
+		}
+		if err := p.flush(); err != nil {
+			t.Fatalf("%s: flush: %v", tt.format, err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s output of %v:\n%s\nwant:\n%s", tt.format, tt.feature, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// e7 is the factor between decimal degrees and the E7 integers of a Point
+const e7 = 1e7
+
+// pointFromDegrees turns a decimal-degree latitude and longitude, e.g. 40.9146138,-74.6188906,
+// into a Point
+func pointFromDegrees(lat, lng float64) (*protos.Point, error) {
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("latitude %v is not between -90 and 90", lat)
+	}
+	if math.IsNaN(lng) || lng < -180 || lng > 180 {
+		return nil, fmt.Errorf("longitude %v is not between -180 and 180", lng)
+	}
+	return &protos.Point{
+		Latitude:  int32(math.Round(lat * e7)),
+		Longitude: int32(math.Round(lng * e7)),
+	}, nil
+}
+
+// parsePoint parses "lat,lng" in decimal degrees
+func parsePoint(s string) (*protos.Point, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%q is not lat,lng", s)
+	}
+	degrees, err := parseDegrees(parts)
+	if err != nil {
+		return nil, err
+	}
+	return pointFromDegrees(degrees[0], degrees[1])
+}
+
+// parseBBox parses "lat1,lng1,lat2,lng2", two opposite corners in decimal degrees
+func parseBBox(s string) (*protos.Rectangle, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("%q is not lat1,lng1,lat2,lng2", s)
+	}
+	degrees, err := parseDegrees(parts)
+	if err != nil {
+		return nil, err
+	}
+	lo, err := pointFromDegrees(degrees[0], degrees[1])
+	if err != nil {
+		return nil, err
+	}
+	hi, err := pointFromDegrees(degrees[2], degrees[3])
+	if err != nil {
+		return nil, err
+	}
+	return &protos.Rectangle{Lo: lo, Hi: hi}, nil
+}
+
+// readPoints reads a route from a GPX or CSV file, "-" being stdin. The format follows the
+// extension, format overrides it and is required for stdin.
+func readPoints(path, format string) ([]*protos.Point, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var points []*protos.Point
+	var err error
+	switch format {
+	case "gpx":
+		points, err = readGPX(r)
+	case "csv":
+		points, err = readCSV(r)
+	default:
+		return nil, fmt.Errorf("%s: unknown route format %q, use gpx or csv", path, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("%s: no points", path)
+	}
+	return points, nil
+}
+
+// ------ Unexported helpers ------ //
+
+func parseDegrees(parts []string) ([]float64, error) {
+	degrees := make([]float64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a decimal degree", part)
+		}
+		degrees[i] = v
+	}
+	return degrees, nil
+}
+
+// gpxPoint is any of a GPX file's trkpt, rtept or wpt elements
+type gpxPoint struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+// readGPX collects the track points of a GPX file in order, falling back to its route points
+// and then its waypoints when it has no track
+func readGPX(r io.Reader) ([]*protos.Point, error) {
+	var doc struct {
+		Tracks []struct {
+			Segments []struct {
+				Points []gpxPoint `xml:"trkpt"`
+			} `xml:"trkseg"`
+		} `xml:"trk"`
+		Routes []struct {
+			Points []gpxPoint `xml:"rtept"`
+		} `xml:"rte"`
+		Waypoints []gpxPoint `xml:"wpt"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	var raw []gpxPoint
+	for _, track := range doc.Tracks {
+		for _, segment := range track.Segments {
+			raw = append(raw, segment.Points...)
+		}
+	}
+	if len(raw) == 0 {
+		for _, route := range doc.Routes {
+			raw = append(raw, route.Points...)
+		}
+	}
+	if len(raw) == 0 {
+		raw = doc.Waypoints
+	}
+	points := make([]*protos.Point, 0, len(raw))
+	for i, p := range raw {
+		point, err := pointFromDegrees(p.Lat, p.Lon)
+		if err != nil {
+			return nil, fmt.Errorf("point %d: %v", i+1, err)
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// readCSV reads lat,lng rows in decimal degrees. Blank lines, # comments and a header row
+// are skipped, extra columns such as a timestamp are ignored.
+func readCSV(r io.Reader) ([]*protos.Point, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	var points []*protos.Point
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return points, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("row %d: want lat,lng", row)
+		}
+		degrees, err := parseDegrees(record[:2])
+		if err != nil {
+			if row == 1 {
+				// a header such as lat,lng
+				continue
+			}
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		point, err := pointFromDegrees(degrees[0], degrees[1])
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		points = append(points, point)
+	}
+}
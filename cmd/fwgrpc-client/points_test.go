@@ -0,0 +1,267 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+func TestParsePoint(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *protos.Point
+		wantErr string
+	}{
+		{in: "40.9146138,-74.6188906", want: &protos.Point{Latitude: 409146138, Longitude: -746188906}},
+		{in: " 40.5 , -74 ", want: &protos.Point{Latitude: 405000000, Longitude: -740000000}},
+		{in: "-90,180", want: &protos.Point{Latitude: -900000000, Longitude: 1800000000}},
+		{in: "40.5", wantErr: "is not lat,lng"},
+		{in: "1,2,3", wantErr: "is not lat,lng"},
+		{in: "north,-74", wantErr: "is not a decimal degree"},
+		{in: "90.1,0", wantErr: "latitude 90.1 is not between -90 and 90"},
+		{in: "0,-180.5", wantErr: "longitude -180.5 is not between -180 and 180"},
+		{in: "NaN,0", wantErr: "latitude NaN"},
+	}
+	for _, tt := range tests {
+		got, err := parsePoint(tt.in)
+		if !matchesError(err, tt.wantErr) {
+			t.Errorf("parsePoint(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == "" && !proto.Equal(got, tt.want) {
+			t.Errorf("parsePoint(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseBBox(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *protos.Rectangle
+		wantErr string
+	}{
+		{
+			in: "40,-75,41,-74",
+			want: &protos.Rectangle{
+				Lo: &protos.Point{Latitude: 400000000, Longitude: -750000000},
+				Hi: &protos.Point{Latitude: 410000000, Longitude: -740000000},
+			},
+		},
+		{
+			// the corners are taken as given, the server normalizes them
+			in: "41,-74,40,-75",
+			want: &protos.Rectangle{
+				Lo: &protos.Point{Latitude: 410000000, Longitude: -740000000},
+				Hi: &protos.Point{Latitude: 400000000, Longitude: -750000000},
+			},
+		},
+		{in: "40,-75,41", wantErr: "is not lat1,lng1,lat2,lng2"},
+		{in: "40,-75,41,-74,0", wantErr: "is not lat1,lng1,lat2,lng2"},
+		{in: "40,-75,41,east", wantErr: `"east" is not a decimal degree`},
+		{in: "95,-75,41,-74", wantErr: "latitude 95 is not between -90 and 90"},
+		{in: "40,-75,41,200", wantErr: "longitude 200 is not between -180 and 180"},
+	}
+	for _, tt := range tests {
+		got, err := parseBBox(tt.in)
+		if !matchesError(err, tt.wantErr) {
+			t.Errorf("parseBBox(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == "" && !proto.Equal(got, tt.want) {
+			t.Errorf("parseBBox(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReadGPX(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []*protos.Point
+		wantErr string
+	}{
+		{
+			name: "track segments in order",
+			in: `<gpx><trk>
+				<trkseg><trkpt lat="40.1" lon="-74.1"/><trkpt lat="40.2" lon="-74.2"/></trkseg>
+				<trkseg><trkpt lat="40.3" lon="-74.3"/></trkseg>
+			</trk><wpt lat="1" lon="1"/></gpx>`,
+			want: points(t, "40.1,-74.1", "40.2,-74.2", "40.3,-74.3"),
+		},
+		{
+			name: "route points without a track",
+			in:   `<gpx><rte><rtept lat="40.1" lon="-74.1"/><rtept lat="40.2" lon="-74.2"/></rte><wpt lat="1" lon="1"/></gpx>`,
+			want: points(t, "40.1,-74.1", "40.2,-74.2"),
+		},
+		{
+			name: "waypoints only",
+			in:   `<gpx><wpt lat="40.1" lon="-74.1"/></gpx>`,
+			want: points(t, "40.1,-74.1"),
+		},
+		{
+			name: "nothing",
+			in:   `<gpx></gpx>`,
+		},
+		{
+			name:    "point out of range",
+			in:      `<gpx><trk><trkseg><trkpt lat="40.1" lon="-74.1"/><trkpt lat="91" lon="0"/></trkseg></trk></gpx>`,
+			wantErr: "point 2: latitude 91 is not between -90 and 90",
+		},
+		{
+			name:    "not xml",
+			in:      `lat,lng`,
+			wantErr: "EOF",
+		},
+		{
+			name:    "bad attribute",
+			in:      `<gpx><wpt lat="north" lon="0"/></gpx>`,
+			wantErr: "invalid syntax",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readGPX(strings.NewReader(tt.in))
+			if !matchesError(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			expectPoints(t, got, tt.want)
+		})
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []*protos.Point
+		wantErr string
+	}{
+		{
+			name: "rows",
+			in:   "40.1,-74.1\n40.2,-74.2\n",
+			want: points(t, "40.1,-74.1", "40.2,-74.2"),
+		},
+		{
+			name: "header, comments, blank lines and extra columns",
+			in:   "lat,lng,time\n# morning walk\n\n40.1, -74.1,2019-05-01T08:00:00Z\n40.2,-74.2,2019-05-01T08:05:00Z\n",
+			want: points(t, "40.1,-74.1", "40.2,-74.2"),
+		},
+		{
+			name: "empty",
+			in:   "",
+		},
+		{
+			name:    "one column",
+			in:      "40.1,-74.1\n40.2\n",
+			wantErr: "row 2: want lat,lng",
+		},
+		{
+			name:    "not a number after the header",
+			in:      "lat,lng\n40.1,west\n",
+			wantErr: `row 2: "west" is not a decimal degree`,
+		},
+		{
+			name:    "out of range",
+			in:      "40.1,-74.1\n40.2,-181\n",
+			wantErr: "row 2: longitude -181 is not between -180 and 180",
+		},
+		{
+			name:    "unbalanced quote",
+			in:      "40.1,\"-74.1\n",
+			wantErr: "extraneous or missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCSV(strings.NewReader(tt.in))
+			if !matchesError(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			expectPoints(t, got, tt.want)
+		})
+	}
+}
+
+func TestReadPoints(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	gpx := write("walk.GPX", `<gpx><wpt lat="40.1" lon="-74.1"/></gpx>`)
+	csv := write("walk.csv", "40.1,-74.1\n")
+	txt := write("walk.txt", "40.1,-74.1\n")
+	empty := write("empty.csv", "lat,lng\n")
+	bad := write("bad.csv", "40.1,-74.1\n91,0\n")
+
+	tests := []struct {
+		name    string
+		path    string
+		format  string
+		wantErr string
+	}{
+		{name: "gpx by extension", path: gpx},
+		{name: "csv by extension", path: csv},
+		{name: "format overrides the extension", path: txt, format: "csv"},
+		{name: "unknown extension", path: txt, wantErr: `walk.txt: unknown route format "txt", use gpx or csv`},
+		{name: "wrong format", path: csv, format: "gpx", wantErr: "walk.csv: EOF"},
+		{name: "no points", path: empty, wantErr: "empty.csv: no points"},
+		{name: "bad row", path: bad, wantErr: "bad.csv: row 2: latitude 91"},
+		{name: "missing file", path: filepath.Join(dir, "missing.csv"), wantErr: "no such file or directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readPoints(tt.path, tt.format)
+			if !matchesError(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.wantErr == "" {
+				expectPoints(t, got, points(t, "40.1,-74.1"))
+			}
+		})
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// matchesError is true when err contains want, or err is nil and want is empty
+func matchesError(err error, want string) bool {
+	if err == nil || want == "" {
+		return err == nil && want == ""
+	}
+	return strings.Contains(err.Error(), want)
+}
+
+// points parses each "lat,lng"
+func points(t *testing.T, lines ...string) []*protos.Point {
+	t.Helper()
+	var out []*protos.Point
+	for _, line := range lines {
+		point, err := parsePoint(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, point)
+	}
+	return out
+}
+
+func expectPoints(t *testing.T, got, want []*protos.Point) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d points %v, want %v", len(got), got, want)
+	}
+	for i := range want {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("point %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
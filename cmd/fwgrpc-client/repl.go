@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/protobuf/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/client"
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+const (
+	// reconnectMin and reconnectMax bound the wait between reconnects, it doubles after every failure
+	reconnectMin = 500 * time.Millisecond
+	reconnectMax = 30 * time.Second
+
+	replHelp = `/move lat lng   set your location, in decimal degrees
+/history        show the notes left at your location
+/quit           leave, also on end of input
+anything else is left as a note at your location`
+)
+
+// repl is an interactive RouteChat. Lines read from in are notes left at the current location or
+// commands, notes from other chatters are written to out as the server sends them, wherever they
+// were left. The server sends a connection every note once, but a new connection is sent the notes
+// seen on earlier ones again when a note is left at their location, the repl only shows those once.
+// A lost connection is reopened with backoff and notes the server hadn't answered yet are sent again.
+type repl struct {
+	client *client.Client
+	in     io.Reader
+	out    io.Writer
+	// prompt is written before every line read, for terminals
+	prompt   bool
+	location *protos.Point
+
+	// history holds the notes seen at each location in the order they were first seen
+	history map[string][]*protos.RouteNote
+	// replayed counts the notes received on the current connection by location and message, see
+	// noteKey. Whatever it has more of than history is new.
+	replayed map[string]int
+	// pending are the notes sent but not answered yet, oldest first
+	pending []*protos.RouteNote
+
+	// chat is nil while disconnected
+	chat       *client.Chat
+	cancelChat context.CancelFunc
+	received   chan chatEvent
+	retry      <-chan time.Time
+	backoff    time.Duration
+	// reconnecting is set once a connection was lost
+	reconnecting bool
+}
+
+// chatEvent is a note or the error that ended a connection
+type chatEvent struct {
+	chat *client.Chat
+	note *protos.RouteNote
+	err  error
+}
+
+func newREPL(c *client.Client, in io.Reader, out io.Writer) *repl {
+	return &repl{
+		client:   c,
+		in:       in,
+		out:      out,
+		history:  make(map[string][]*protos.RouteNote),
+		replayed: make(map[string]int),
+		received: make(chan chatEvent),
+		backoff:  reconnectMin,
+	}
+}
+
+// run reads lines until /quit or the end of in and returns once the server has answered
+// the notes sent. Errors the server won't recover from, e.g. Unauthenticated, end it early.
+func (r *repl) run(ctx context.Context) error {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r.in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	defer r.disconnect()
+
+	r.connect(ctx)
+	r.showPrompt()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok || strings.TrimSpace(line) == "/quit" {
+				return r.quit(ctx)
+			}
+			r.handle(line)
+			r.showPrompt()
+		case ev := <-r.received:
+			if ev.chat != r.chat {
+				// left over from a connection that was already given up
+				continue
+			}
+			if ev.err != nil {
+				if err := r.lost(ev.err); err != nil {
+					return err
+				}
+				continue
+			}
+			if r.receive(ev.note) {
+				r.showPrompt()
+			}
+		case <-r.retry:
+			r.retry = nil
+			r.connect(ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// handle runs a command or sends a note
+func (r *repl) handle(line string) {
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "":
+	case line == "/help":
+		fmt.Fprintln(r.out, replHelp)
+	case line == "/history":
+		r.showHistory()
+	case strings.HasPrefix(line, "/move"):
+		point, err := parseMove(strings.TrimSpace(strings.TrimPrefix(line, "/move")))
+		if err != nil {
+			fmt.Fprintf(r.out, "! %v\n", err)
+			return
+		}
+		r.location = point
+		lat, lng := degrees(point)
+		fmt.Fprintf(r.out, "* you are at %s,%s\n", lat, lng)
+	case strings.HasPrefix(line, "/"):
+		fmt.Fprintf(r.out, "! unknown command %s, try /help\n", strings.Fields(line)[0])
+	case r.location == nil:
+		fmt.Fprintln(r.out, "! set your location first with /move lat lng")
+	default:
+		note := &protos.RouteNote{Location: r.location, Message: line}
+		r.pending = append(r.pending, note)
+		if r.chat != nil {
+			// a failed send ends the connection, the note goes out again after reconnecting
+			r.chat.Send(note)
+		}
+	}
+}
+
+// receive records a note from the server and shows it unless it was seen before or is our own.
+// It reports whether anything was written.
+func (r *repl) receive(note *protos.RouteNote) bool {
+	r.backoff = reconnectMin
+	key := locationKey(note.Location)
+	r.replayed[noteKey(note)]++
+	if r.replayed[noteKey(note)] <= countMessage(r.history[key], note.Message) {
+		// seen on an earlier connection. Notes alike can't be told apart on screen, so counting
+		// rather than comparing in order is enough and also copes with a server that lost some.
+		return false
+	}
+	r.history[key] = append(r.history[key], note)
+	if len(r.pending) > 0 && proto.Equal(note, r.pending[0]) {
+		// our own note ends the answer. A note just like it that someone left right before is
+		// taken for ours, ours then shows up in its place.
+		r.pending = r.pending[1:]
+		return false
+	}
+	lat, lng := degrees(note.Location)
+	fmt.Fprintf(r.out, "[%s,%s] %s\n", lat, lng, note.Message)
+	return true
+}
+
+func (r *repl) showHistory() {
+	if r.location == nil {
+		fmt.Fprintln(r.out, "! set your location first with /move lat lng")
+		return
+	}
+	notes := r.history[locationKey(r.location)]
+	if len(notes) == 0 {
+		fmt.Fprintln(r.out, "* no notes seen here yet")
+		return
+	}
+	for _, note := range notes {
+		fmt.Fprintf(r.out, "  %s\n", note.Message)
+	}
+}
+
+// connect opens a chat and resends the unanswered notes, or schedules another try
+func (r *repl) connect(ctx context.Context) {
+	chatCtx, cancel := context.WithCancel(ctx)
+	chat, err := r.client.Chat(chatCtx)
+	if err != nil {
+		cancel()
+		r.scheduleRetry(err)
+		return
+	}
+	r.chat, r.cancelChat = chat, cancel
+	r.replayed = make(map[string]int)
+	if r.reconnecting {
+		r.reconnecting = false
+		fmt.Fprintln(r.out, "* reconnected")
+	}
+	go func() {
+		for {
+			note, err := chat.Recv()
+			select {
+			case r.received <- chatEvent{chat: chat, note: note, err: err}:
+			case <-chatCtx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for _, note := range r.pending {
+		if chat.Send(note) != nil {
+			break
+		}
+	}
+}
+
+// lost handles the end of a connection, errors that reconnecting won't fix are returned
+func (r *repl) lost(err error) error {
+	r.disconnect()
+	if err == io.EOF {
+		err = status.Errorf(codes.Unavailable, "server ended the chat")
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Unknown, codes.DeadlineExceeded:
+		r.scheduleRetry(err)
+		return nil
+	}
+	return err
+}
+
+func (r *repl) scheduleRetry(err error) {
+	fmt.Fprintf(r.out, "! connection lost: %s, reconnecting in %s\n", errorMessage(err), r.backoff)
+	r.reconnecting = true
+	r.retry = time.After(r.backoff)
+	if r.backoff *= 2; r.backoff > reconnectMax {
+		r.backoff = reconnectMax
+	}
+}
+
+func (r *repl) disconnect() {
+	if r.chat != nil {
+		r.cancelChat()
+		r.chat = nil
+	}
+}
+
+// quit waits for the server to answer the notes sent, showing what comes in meanwhile
+func (r *repl) quit(ctx context.Context) error {
+	if r.chat == nil {
+		if len(r.pending) > 0 {
+			fmt.Fprintf(r.out, "! %d notes were not delivered\n", len(r.pending))
+		}
+		return nil
+	}
+	r.chat.CloseSend()
+	for {
+		select {
+		case ev := <-r.received:
+			if ev.chat != r.chat {
+				continue
+			}
+			if ev.err == io.EOF {
+				return nil
+			}
+			if ev.err != nil {
+				if len(r.pending) > 0 {
+					fmt.Fprintf(r.out, "! %d notes were not delivered\n", len(r.pending))
+				}
+				return ev.err
+			}
+			r.receive(ev.note)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *repl) showPrompt() {
+	if r.prompt {
+		fmt.Fprint(r.out, "> ")
+	}
+}
+
+// parseMove parses the arguments of /move, "lat lng" or "lat,lng"
+func parseMove(args string) (*protos.Point, error) {
+	fields := strings.Fields(strings.Replace(args, ",", " ", 1))
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("usage: /move lat lng")
+	}
+	return parsePoint(fields[0] + "," + fields[1])
+}
+
+// countMessage counts the notes carrying message
+func countMessage(notes []*protos.RouteNote, message string) int {
+	n := 0
+	for _, note := range notes {
+		if note.Message == message {
+			n++
+		}
+	}
+	return n
+}
+
+// noteKey is what tells notes apart on screen, their location and message
+func noteKey(note *protos.RouteNote) string {
+	return locationKey(note.Location) + " " + note.Message
+}
+
+func locationKey(point *protos.Point) string {
+	if point == nil {
+		return ""
+	}
+	return strconv.Itoa(int(point.Latitude)) + "," + strconv.Itoa(int(point.Longitude))
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
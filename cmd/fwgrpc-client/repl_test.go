@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/protobuf/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/client"
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+	"gitlab.com/ethanlewis787/fun-with-grpc/server"
+)
+
+// dropMessage makes the test server end the chat the first time it receives it
+const dropMessage = "drop me"
+
+func TestREPL(t *testing.T) {
+	srv := newTestServer(t)
+	c := srv.client(t)
+	r := startREPL(t, c)
+
+	r.typeLine("no location yet")
+	r.expectLines("! set your location first with /move lat lng")
+	r.typeLine("/move 1 2")
+	r.expectLines("* you are at 1,2")
+	r.typeLine("/history")
+	r.expectLines("* no notes seen here yet")
+
+	// watcher sees every note as the server stores it
+	watcher := watch(t, c)
+	srv.waitChats(t, 2)
+
+	// notes others leave show up, our own never do
+	leaveNote(t, c, 1, 2, "from bob")
+	r.expectLines("[1,2] from bob")
+	r.typeLine("hello")
+	expectNotes(t, watcher, "from bob", "hello")
+
+	// bob's note says the same as ours, it is not hidden as a replay
+	leaveNote(t, c, 1, 2, "same")
+	r.expectLines("[1,2] same")
+	r.typeLine("same")
+	expectNotes(t, watcher, "same", "same")
+	// the chat sends notes in order, once bob's next one shows up the answer to ours is in
+	leaveNote(t, c, 1, 2, "bye")
+	r.expectLines("[1,2] bye")
+	r.typeLine("/history")
+	r.expectLines("  from bob", "  hello", "  same", "  same", "  bye")
+
+	// the server ends the chat before answering, the note goes out again after reconnecting
+	// and the notes seen before aren't shown again
+	r.typeLine("/move 3,4")
+	r.expectLines("* you are at 3,4")
+	leaveNote(t, c, 3, 4, "waiting")
+	r.expectLines("[3,4] waiting")
+	r.typeLine(dropMessage)
+	r.expectLines(
+		"! connection lost: Unavailable: dropped for the test, reconnecting in 500ms",
+		"* reconnected",
+	)
+	expectNotes(t, watcher, "bye", "waiting", dropMessage)
+	// the server stored the note once
+	answer := leaveNote(t, c, 3, 4, "did it arrive")
+	if got, want := messages(answer), []string{"waiting", dropMessage, "did it arrive"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("notes at 3,4 = %q, want %q", got, want)
+	}
+	r.expectLines("[3,4] did it arrive")
+
+	r.typeLine("/quit")
+	if err := r.wait(); err != nil {
+		t.Errorf("run = %v, want nil after /quit", err)
+	}
+	if line, ok := <-r.lines; ok {
+		t.Errorf("unexpected output %q", line)
+	}
+}
+
+// A chatter who doesn't say anything sees the notes others leave as they are left.
+func TestREPLLiveNotes(t *testing.T) {
+	srv := newTestServer(t)
+	bob := startREPL(t, srv.client(t))
+	bob.typeLine("/move 7 8")
+	bob.expectLines("* you are at 7,8")
+	alice := startREPL(t, srv.client(t))
+	alice.typeLine("/move 7 8")
+	alice.expectLines("* you are at 7,8")
+	srv.waitChats(t, 2)
+
+	alice.typeLine("anyone here?")
+	bob.expectLines("[7,8] anyone here?")
+	bob.typeLine("hi alice")
+	alice.expectLines("[7,8] hi alice")
+
+	for name, r := range map[string]*testREPL{"alice": alice, "bob": bob} {
+		r.typed.Close()
+		if err := r.wait(); err != nil {
+			t.Errorf("%s: run = %v, want nil at the end of input", name, err)
+		}
+		if line, ok := <-r.lines; ok {
+			t.Errorf("%s: unexpected output %q", name, line)
+		}
+	}
+}
+
+// Leaving input without /quit waits for the answers to the notes sent before returning.
+func TestREPLEndOfInput(t *testing.T) {
+	c := newTestServer(t).client(t)
+	leaveNote(t, c, 5, 6, "already here")
+	r := startREPL(t, c)
+	io.WriteString(r.typed, "/move 5 6\nmy note\n")
+	r.typed.Close()
+	r.expectLines("* you are at 5,6", "[5,6] already here")
+	if err := r.wait(); err != nil {
+		t.Errorf("run = %v, want nil at the end of input", err)
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// testServer serves a RouteGuide over bufconn that drops the first chat to receive dropMessage
+type testServer struct {
+	lis *bufconn.Listener
+
+	mu sync.Mutex
+	// chats counts the chats the server is reading notes from
+	chats int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{lis: bufconn.Listen(1 << 20)}
+	rs := &server.RouteGuideServerImpl{RouteNotes: make(map[string][]*protos.RouteNote)}
+	grpcServer := grpc.NewServer(grpc.StreamInterceptor(s.dropOnce()))
+	protos.RegisterRouteGuideServer(grpcServer, rs)
+	go grpcServer.Serve(s.lis)
+	t.Cleanup(grpcServer.Stop)
+	return s
+}
+
+// client opens a connection of its own to the server
+func (s *testServer) client(t *testing.T) *client.Client {
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.lis.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return client.New(conn, nil)
+}
+
+// waitChats waits until the server reads notes from n chats, the notes left from then on are
+// sent to all of them
+func (s *testServer) waitChats(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		chats := s.chats
+		s.mu.Unlock()
+		if chats == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the server reads from %d chats, want %d", chats, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *testServer) countChat(delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chats += delta
+}
+
+// dropOnce fails the stream the first time a note carrying dropMessage arrives, before the
+// server stores or answers it. It counts the chats once they start reading.
+func (s *testServer) dropOnce() grpc.StreamServerInterceptor {
+	var once sync.Once
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		stream := &droppingStream{ServerStream: ss, once: &once, server: s}
+		err := handler(srv, stream)
+		if stream.reading {
+			s.countChat(-1)
+		}
+		return err
+	}
+}
+
+type droppingStream struct {
+	grpc.ServerStream
+	once *sync.Once
+	// reading is set, and the chat counted, on the first RecvMsg
+	server  *testServer
+	reading bool
+}
+
+func (s *droppingStream) RecvMsg(m interface{}) error {
+	if !s.reading {
+		s.reading = true
+		s.server.countChat(1)
+	}
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	var err error
+	if note, ok := m.(*protos.RouteNote); ok && note.Message == dropMessage {
+		s.once.Do(func() {
+			err = status.Errorf(codes.Unavailable, "dropped for the test")
+		})
+	}
+	return err
+}
+
+// leaveNote leaves a note as another chatter and returns the server's answer, every note at the location
+func leaveNote(t *testing.T, c *client.Client, lat, lng int32, message string) []*protos.RouteNote {
+	note := &protos.RouteNote{Location: &protos.Point{Latitude: lat * e7, Longitude: lng * e7}, Message: message}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chat, err := c.Chat(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chat.Close()
+	if err := chat.Send(note); err != nil {
+		t.Fatal(err)
+	}
+	var answer []*protos.RouteNote
+	for {
+		got, err := chat.Recv()
+		if err != nil {
+			t.Fatalf("waiting for the answer to %q: %v", message, err)
+		}
+		answer = append(answer, got)
+		// the answer ends with the note itself
+		if proto.Equal(got, note) {
+			return answer
+		}
+	}
+}
+
+// watch opens a chat that never leaves a note and sends the notes it receives
+func watch(t *testing.T, c *client.Client) <-chan *protos.RouteNote {
+	ctx, cancel := context.WithCancel(context.Background())
+	chat, err := c.Chat(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cancel)
+	notes := make(chan *protos.RouteNote, 100)
+	go func() {
+		for {
+			note, err := chat.Recv()
+			if err != nil {
+				return
+			}
+			notes <- note
+		}
+	}()
+	return notes
+}
+
+// expectNotes reads the next notes and compares their messages in order
+func expectNotes(t *testing.T, notes <-chan *protos.RouteNote, messages ...string) {
+	t.Helper()
+	for _, message := range messages {
+		select {
+		case note := <-notes:
+			if note.Message != message {
+				t.Fatalf("received %q, want %q", note.Message, message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no note, want %q", message)
+		}
+	}
+}
+
+func messages(notes []*protos.RouteNote) []string {
+	var msgs []string
+	for _, note := range notes {
+		msgs = append(msgs, note.Message)
+	}
+	return msgs
+}
+
+// testREPL is a repl running on pipes
+type testREPL struct {
+	t     *testing.T
+	typed *io.PipeWriter
+	lines <-chan string
+	done  chan error
+}
+
+func startREPL(t *testing.T, c *client.Client) *testREPL {
+	in, typed := io.Pipe()
+	output, out := io.Pipe()
+	r := &testREPL{t: t, typed: typed, lines: readLines(output), done: make(chan error, 1)}
+	go func() {
+		r.done <- newREPL(c, in, out).run(context.Background())
+		out.Close()
+	}()
+	return r
+}
+
+func (r *testREPL) typeLine(line string) {
+	if _, err := io.WriteString(r.typed, line+"\n"); err != nil {
+		r.t.Fatalf("typing %q: %v", line, err)
+	}
+}
+
+func (r *testREPL) expectLines(want ...string) {
+	r.t.Helper()
+	expectLines(r.t, r.lines, want...)
+}
+
+// wait returns what run returned
+func (r *testREPL) wait() error {
+	select {
+	case err := <-r.done:
+		return err
+	case <-time.After(5 * time.Second):
+		r.t.Fatal("run did not return")
+		return nil
+	}
+}
+
+// readLines sends every line written to r, the channel is closed at the end of r
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string, 100)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return lines
+}
+
+// expectLines reads the next lines of output and compares them in order
+func expectLines(t *testing.T, lines <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("output ended, want %q", w)
+			}
+			if line != w {
+				t.Fatalf("output %q, want %q", line, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no output, want %q", w)
+		}
+	}
+}
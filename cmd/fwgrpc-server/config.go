@@ -1,6 +1,207 @@
 package main
 
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/ratelimit"
+	"gitlab.com/ethanlewis787/fun-with-grpc/server"
+)
+
 type config struct {
-	filePath string
-	gRCPPort string
+	// configFile is layered under the flags and environment variables, see configfile.Load
+	configFile string
+	filePath   string
+	gRCPPort   string
+	// listenAddress is a comma separated list of host:port and unix:// addresses, localhost:gRCPPort when empty
+	listenAddress  string
+	unixSocketMode string
+	// distanceMode is either haversine or vincenty
+	distanceMode string
+	// maxListResults bounds the features sent by a single ListFeatures call
+	maxListResults int
+	// TLS is off unless both tlsCert and tlsKey are set, tlsClientCA turns on mutual TLS
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string
+	// auth is on when a token file or a JWKS file is set
+	authTokenFile   string
+	authJWKSFile    string
+	authJWTIssuer   string
+	authJWTAudience string
+	authPolicyFile  string
+	// reflection registers the gRPC server reflection service
+	reflection bool
+	// shutdownTimeout is how long in-flight RPCs get to finish before they are cut off
+	shutdownTimeout time.Duration
+	// shutdownDelay is how long the server keeps serving after health turns NOT_SERVING
+	shutdownDelay time.Duration
+	// connection settings, see connectionOptions
+	keepaliveTime                time.Duration
+	keepaliveTimeout             time.Duration
+	keepaliveMinTime             time.Duration
+	keepalivePermitWithoutStream bool
+	maxConnectionAge             time.Duration
+	maxConnectionAgeGrace        time.Duration
+	// message size limits in bytes, for both the public and the gateway server
+	maxRecvMsgSize int
+	maxSendMsgSize int
+	// metricsAddr serves Prometheus metrics on /metrics, disabled when empty
+	metricsAddr string
+	// gatewayAddr serves the REST/JSON gateway, disabled when empty
+	gatewayAddr string
+	// grpcWebAddr serves gRPC-Web, disabled when empty
+	grpcWebAddr string
+	// allowedOrigins are the comma separated cross site origins browsers may use the gateway from
+	allowedOrigins string
+	// tracing exporter settings, see tracing.Options
+	traceExporter  string
+	traceFile      string
+	otlpEndpoint   string
+	otlpInsecure   bool
+	traceBatchSize int
+	// logging settings, see logging.Options
+	logLevel    string
+	logFormat   string
+	logSampling bool
+	logOutput   string
+	// per client limits, see ratelimit.Options
+	limitRate        float64
+	limitBurst       int
+	limitConcurrency string
+	limitStreamRate  float64
+	limitStreamBurst int
+}
+
+// validate checks the merged flags, environment variables and settings file before anything starts
+func (c *config) validate() error {
+	if port, err := strconv.Atoi(c.gRCPPort); err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("port: %q is not a port number", c.gRCPPort)
+	}
+	for _, address := range splitAddresses(c.listenAddress) {
+		if err := checkAddress(address); err != nil {
+			return fmt.Errorf("listen-address: %v", err)
+		}
+	}
+	if _, err := c.socketMode(); err != nil {
+		return fmt.Errorf("unix-socket-mode: %q is not an octal file mode", c.unixSocketMode)
+	}
+	if _, err := server.ParseDistanceMode(c.distanceMode); err != nil {
+		return fmt.Errorf("distance-mode: %v", err)
+	}
+	if c.maxListResults <= 0 {
+		return fmt.Errorf("max-list-results: must be positive")
+	}
+	if (c.tlsCert == "") != (c.tlsKey == "") {
+		return fmt.Errorf("tls-cert and tls-key must be set together")
+	}
+	if c.tlsClientCA != "" && c.tlsCert == "" {
+		return fmt.Errorf("tls-client-ca: mutual TLS needs tls-cert and tls-key")
+	}
+	if c.authPolicyFile != "" && c.authTokenFile == "" && c.authJWKSFile == "" {
+		return fmt.Errorf("auth-policy-file: needs auth-token-file or auth-jwks-file")
+	}
+	if c.authJWKSFile == "" && (c.authJWTIssuer != "" || c.authJWTAudience != "") {
+		return fmt.Errorf("auth-jwt-issuer and auth-jwt-audience need auth-jwks-file")
+	}
+	// the gateway forwards the bearer tokens it is sent, they must not cross the network in the clear
+	if c.gatewayAddr != "" && (c.authTokenFile != "" || c.authJWKSFile != "") && c.tlsCert == "" {
+		return fmt.Errorf("gateway-address: serving the gateway with auth needs tls-cert and tls-key")
+	}
+	if c.shutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown-timeout: must be positive")
+	}
+	if c.shutdownDelay < 0 {
+		return fmt.Errorf("shutdown-delay: must not be negative")
+	}
+	if c.keepaliveTime <= 0 || c.keepaliveTimeout <= 0 {
+		return fmt.Errorf("keepalive-time and keepalive-timeout must be positive")
+	}
+	if c.keepaliveMinTime < 0 || c.maxConnectionAge < 0 || c.maxConnectionAgeGrace < 0 {
+		return fmt.Errorf("keepalive-min-time, max-connection-age and max-connection-age-grace must not be negative")
+	}
+	// clients pinging as often as the server does would otherwise be disconnected for too many pings
+	if c.keepaliveMinTime > c.keepaliveTime {
+		return fmt.Errorf("keepalive-min-time: must not be longer than keepalive-time")
+	}
+	if c.maxRecvMsgSize <= 0 || c.maxSendMsgSize <= 0 {
+		return fmt.Errorf("max-recv-msg-size and max-send-msg-size must be positive")
+	}
+	switch c.traceExporter {
+	case "stdout", "file", "otlp", "none":
+	default:
+		return fmt.Errorf("trace-exporter: %q is not stdout, file, otlp or none", c.traceExporter)
+	}
+	if c.traceBatchSize <= 0 {
+		return fmt.Errorf("trace-batch-size: must be positive")
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.logLevel)); err != nil {
+		return fmt.Errorf("log-level: %q is not debug, info, warn or error", c.logLevel)
+	}
+	if c.logFormat != "json" && c.logFormat != "console" {
+		return fmt.Errorf("log-format: %q is not json or console", c.logFormat)
+	}
+	if c.limitRate < 0 || c.limitBurst < 0 || c.limitStreamRate < 0 || c.limitStreamBurst < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if _, err := ratelimit.ParseConcurrency(c.limitConcurrency); err != nil {
+		return fmt.Errorf("limit-concurrency: %v", err)
+	}
+	return nil
+}
+
+// listenAddresses is listen-address, falling back to the port on localhost
+func (c *config) listenAddresses() string {
+	if len(splitAddresses(c.listenAddress)) == 0 {
+		return net.JoinHostPort("localhost", c.gRCPPort)
+	}
+	return c.listenAddress
+}
+
+// socketMode parses unix-socket-mode, e.g. 0660
+func (c *config) socketMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(c.unixSocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("bad file mode %q", c.unixSocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// connectionOptions are the keepalive and connection age settings of the public listeners.
+// The server pings idle clients every keepaliveTime and drops those that don't answer within
+// keepaliveTimeout, so streams to peers that vanished behind a NAT are torn down instead of
+// lingering. Clients pinging more often than keepaliveMinTime are disconnected.
+func (c *config) connectionOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(c.keepaliveParams()),
+		grpc.KeepaliveEnforcementPolicy(c.keepalivePolicy()),
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+func (c *config) keepaliveParams() keepalive.ServerParameters {
+	// grpc takes a zero connection age or grace as no limit
+	return keepalive.ServerParameters{
+		Time:                  c.keepaliveTime,
+		Timeout:               c.keepaliveTimeout,
+		MaxConnectionAge:      c.maxConnectionAge,
+		MaxConnectionAgeGrace: c.maxConnectionAgeGrace,
+	}
+}
+
+func (c *config) keepalivePolicy() keepalive.EnforcementPolicy {
+	return keepalive.EnforcementPolicy{
+		MinTime:             c.keepaliveMinTime,
+		PermitWithoutStream: c.keepalivePermitWithoutStream,
+	}
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *config)
+		wantErr string
+	}{
+		{name: "defaults", change: func(c *config) {}},
+		{name: "port out of range", change: func(c *config) { c.gRCPPort = "70000" }, wantErr: "port:"},
+		{name: "bad socket mode", change: func(c *config) { c.unixSocketMode = "0999" }, wantErr: "unix-socket-mode:"},
+		{name: "unknown distance mode", change: func(c *config) { c.distanceMode = "manhattan" }, wantErr: "distance-mode:"},
+		{name: "zero max list results", change: func(c *config) { c.maxListResults = 0 }, wantErr: "max-list-results:"},
+		{name: "cert without key", change: func(c *config) { c.tlsCert = "server.pem" }, wantErr: "tls-cert and tls-key"},
+		{name: "client CA without TLS", change: func(c *config) { c.tlsClientCA = "ca.pem" }, wantErr: "tls-client-ca:"},
+		{
+			name:    "gateway with auth over plaintext",
+			change:  func(c *config) { c.gatewayAddr = "localhost:8080"; c.authTokenFile = "tokens.json" },
+			wantErr: "gateway-address:",
+		},
+		{
+			name: "gateway with auth over TLS",
+			change: func(c *config) {
+				c.gatewayAddr = "localhost:8080"
+				c.authTokenFile = "tokens.json"
+				c.tlsCert, c.tlsKey = "server.pem", "server-key.pem"
+			},
+		},
+		{name: "zero shutdown timeout", change: func(c *config) { c.shutdownTimeout = 0 }, wantErr: "shutdown-timeout:"},
+		{name: "negative shutdown delay", change: func(c *config) { c.shutdownDelay = -time.Second }, wantErr: "shutdown-delay:"},
+		{name: "zero keepalive time", change: func(c *config) { c.keepaliveTime = 0 }, wantErr: "keepalive-time and keepalive-timeout"},
+		{name: "negative keepalive timeout", change: func(c *config) { c.keepaliveTimeout = -time.Second }, wantErr: "keepalive-time and keepalive-timeout"},
+		{name: "negative keepalive min time", change: func(c *config) { c.keepaliveMinTime = -time.Second }, wantErr: "must not be negative"},
+		{name: "negative connection age", change: func(c *config) { c.maxConnectionAge = -time.Second }, wantErr: "must not be negative"},
+		{name: "negative connection age grace", change: func(c *config) { c.maxConnectionAgeGrace = -time.Second }, wantErr: "must not be negative"},
+		{
+			name:    "min time longer than keepalive time",
+			change:  func(c *config) { c.keepaliveMinTime = time.Minute },
+			wantErr: "keepalive-min-time: must not be longer than keepalive-time",
+		},
+		{name: "min time equal to keepalive time", change: func(c *config) { c.keepaliveMinTime = c.keepaliveTime }},
+		{name: "zero message size", change: func(c *config) { c.maxRecvMsgSize = 0 }, wantErr: "max-recv-msg-size"},
+		{name: "unknown trace exporter", change: func(c *config) { c.traceExporter = "jaeger" }, wantErr: "trace-exporter:"},
+		{name: "bad log level", change: func(c *config) { c.logLevel = "loud" }, wantErr: "log-level:"},
+		{name: "bad log format", change: func(c *config) { c.logFormat = "xml" }, wantErr: "log-format:"},
+		{name: "negative rate", change: func(c *config) { c.limitRate = -1 }, wantErr: "limits must not be negative"},
+		{name: "bad concurrency", change: func(c *config) { c.limitConcurrency = "RouteChat" }, wantErr: "limit-concurrency:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultConfig()
+			tt.change(c)
+			err := c.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConnectionOptions(t *testing.T) {
+	c := defaultConfig()
+	c.keepaliveTime = 20 * time.Second
+	c.keepaliveTimeout = 5 * time.Second
+	c.keepaliveMinTime = 15 * time.Second
+	c.keepalivePermitWithoutStream = true
+	c.maxConnectionAge = time.Hour
+	c.maxConnectionAgeGrace = time.Minute
+
+	wantParams := keepalive.ServerParameters{
+		Time:                  20 * time.Second,
+		Timeout:               5 * time.Second,
+		MaxConnectionAge:      time.Hour,
+		MaxConnectionAgeGrace: time.Minute,
+	}
+	if got := c.keepaliveParams(); got != wantParams {
+		t.Errorf("keepaliveParams() = %+v, want %+v", got, wantParams)
+	}
+	wantPolicy := keepalive.EnforcementPolicy{MinTime: 15 * time.Second, PermitWithoutStream: true}
+	if got := c.keepalivePolicy(); got != wantPolicy {
+		t.Errorf("keepalivePolicy() = %+v, want %+v", got, wantPolicy)
+	}
+	if n := len(c.connectionOptions()); n != 2 {
+		t.Errorf("connectionOptions() returned %d options, want 2", n)
+	}
+}
+
+// A server built with connectionOptions sends clients away once max-connection-age is reached.
+func TestConnectionOptionsMaxConnectionAge(t *testing.T) {
+	c := defaultConfig()
+	c.maxConnectionAge = 100 * time.Millisecond
+	c.maxConnectionAgeGrace = 100 * time.Millisecond
+	grpcServer := grpc.NewServer(c.connectionOptions()...)
+	lis := bufconn.Listen(1 << 20)
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn.Connect()
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			t.Fatalf("connection never became ready, last state %s", state)
+		}
+	}
+	if !conn.WaitForStateChange(ctx, connectivity.Ready) {
+		t.Fatal("connection still open after max-connection-age and its grace")
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// defaultConfig is the config the flag defaults produce
+func defaultConfig() *config {
+	return &config{
+		gRCPPort:         "10101",
+		unixSocketMode:   "0660",
+		distanceMode:     "haversine",
+		maxListResults:   100,
+		shutdownTimeout:  30 * time.Second,
+		keepaliveTime:    30 * time.Second,
+		keepaliveTimeout: 10 * time.Second,
+		keepaliveMinTime: 10 * time.Second,
+		maxRecvMsgSize:   4 << 20,
+		maxSendMsgSize:   4 << 20,
+		traceExporter:    "stdout",
+		traceBatchSize:   100,
+		logLevel:         "info",
+		logFormat:        "json",
+		limitRate:        100,
+		limitBurst:       200,
+		limitConcurrency: "RouteChat=10,RecordRoute=10,ListFeatures=5",
+		limitStreamRate:  100,
+		limitStreamBurst: 200,
+	}
+}
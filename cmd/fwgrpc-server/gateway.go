@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/gateway"
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// gatewayBufferSize is the in-memory buffer between the gateway and the gRPC server
+const gatewayBufferSize = 1 << 20
+
+// newGatewayServer builds the REST gateway HTTP server. The gateway reaches the service over an
+// in-memory connection to internal, a gRPC server sharing the interceptors of the public one but not
+// its TLS, so gateway calls are authenticated, limited and logged like any other call.
+// internal is served until it is stopped. The gateway serves HTTPS with tlsConfig when it is set.
+func newGatewayServer(address string, allowedOrigins []string, tlsConfig *tls.Config, internal *grpc.Server) (*http.Server, error) {
+	lis := bufconn.Listen(gatewayBufferSize)
+	go internal.Serve(lis)
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		internal.Stop()
+		return nil, err
+	}
+	gw := gateway.New(protos.NewRouteGuideClient(conn))
+	gw.AllowedOrigins = allowedOrigins
+	// net/http adjusts the config it is given, keep the one the gRPC listener uses untouched
+	gatewayServer := &http.Server{Addr: address, Handler: gw, TLSConfig: tlsConfig.Clone()}
+	gatewayServer.RegisterOnShutdown(func() { conn.Close() })
+	return gatewayServer, nil
+}
+
+// serveHTTP runs the server from newGatewayServer or newGRPCWebServer until it is shut down
+func serveHTTP(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		// the certificate comes from TLSConfig
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
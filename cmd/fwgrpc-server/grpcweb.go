@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"google.golang.org/grpc"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/gateway"
+)
+
+// newGRPCWebServer serves grpcServer to browsers speaking gRPC-Web, including server streaming.
+// Pages from allowedOrigins may call it cross site, CORS preflights are answered for registered
+// methods only. Requests that are not gRPC-Web are handed to grpcServer as plain gRPC.
+// Without tlsConfig both HTTP/1.1 and HTTP/2 with prior knowledge (h2c) are accepted,
+// with it HTTP/2 is negotiated through ALPN.
+func newGRPCWebServer(address string, allowedOrigins []string, tlsConfig *tls.Config, grpcServer *grpc.Server) *http.Server {
+	wrapped := grpcweb.WrapServer(grpcServer,
+		grpcweb.WithOriginFunc(func(origin string) bool {
+			return gateway.OriginAllowed(origin, allowedOrigins)
+		}),
+	)
+	if tlsConfig == nil {
+		return &http.Server{Addr: address, Handler: h2c.NewHandler(wrapped, &http2.Server{})}
+	}
+	// net/http adjusts the config it is given, keep the one the gRPC listener uses untouched
+	return &http.Server{Addr: address, Handler: wrapped, TLSConfig: tlsConfig.Clone()}
+}
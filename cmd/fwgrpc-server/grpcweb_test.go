@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+
+	"github.com/golang/protobuf/proto"
+
+	"google.golang.org/grpc"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+	"gitlab.com/ethanlewis787/fun-with-grpc/server"
+)
+
+const (
+	allowedOrigin = "https://maps.example.com"
+	getFeature    = "/protos.RouteGuide/GetFeature"
+)
+
+var testFeature = &protos.Feature{
+	Name:     "Patriots Path, Mendham, NJ 07945, USA",
+	Location: &protos.Point{Latitude: 407838351, Longitude: -746143763},
+}
+
+func TestGRPCWebUnaryCall(t *testing.T) {
+	srv := newTestGRPCWebServer(t)
+	clients := map[string]*http.Client{
+		"HTTP/1.1": srv.Client(),
+		// h2c, HTTP/2 without TLS
+		"HTTP/2": {Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}},
+	}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			req := &protos.GetFeatureRequest{Latitude: testFeature.Location.Latitude, Longitude: testFeature.Location.Longitude}
+			httpReq, err := http.NewRequest(http.MethodPost, srv.URL+getFeature, bytes.NewReader(grpcWebFrame(0, req)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			httpReq.Header.Set("Content-Type", "application/grpc-web+proto")
+			httpReq.Header.Set("X-Grpc-Web", "1")
+			httpReq.Header.Set("Origin", allowedOrigin)
+			resp, err := client.Do(httpReq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %s", resp.Status)
+			}
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); got != allowedOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, allowedOrigin)
+			}
+			if got := resp.Proto; !strings.HasPrefix(got, name) {
+				t.Errorf("answered over %s, want %s", got, name)
+			}
+
+			messages, trailer := readGRPCWebResponse(t, resp.Body)
+			if !strings.Contains(trailer, "grpc-status: 0") && !strings.Contains(trailer, "grpc-status:0") {
+				t.Errorf("trailer = %q, want grpc-status 0", trailer)
+			}
+			if len(messages) != 1 {
+				t.Fatalf("got %d messages, want 1", len(messages))
+			}
+			feature := &protos.Feature{}
+			if err := proto.Unmarshal(messages[0], feature); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(feature, testFeature) {
+				t.Errorf("feature = %v, want %v", feature, testFeature)
+			}
+		})
+	}
+}
+
+func TestGRPCWebPreflight(t *testing.T) {
+	srv := newTestGRPCWebServer(t)
+	tests := []struct {
+		name       string
+		origin     string
+		path       string
+		wantOrigin string
+	}{
+		{name: "allowed origin", origin: allowedOrigin, path: getFeature, wantOrigin: allowedOrigin},
+		{name: "other origin", origin: "https://evil.example.com", path: getFeature},
+		{name: "unregistered method", origin: allowedOrigin, path: "/protos.RouteGuide/DeleteEverything"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodOptions, srv.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.wantOrigin == "" {
+				return
+			}
+			allowed := strings.ToLower(resp.Header.Get("Access-Control-Allow-Headers"))
+			if !strings.Contains(allowed, "x-grpc-web") {
+				t.Errorf("Access-Control-Allow-Headers = %q, want x-grpc-web among them", allowed)
+			}
+		})
+	}
+}
+
+// Plain gRPC clients can use the gRPC-Web address too, over h2c.
+func TestGRPCWebServesPlainGRPC(t *testing.T) {
+	srv := newTestGRPCWebServer(t)
+	conn, err := grpc.Dial(strings.TrimPrefix(srv.URL, "http://"), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	feature, err := protos.NewRouteGuideClient(conn).GetFeature(context.Background(), &protos.GetFeatureRequest{
+		Latitude:  testFeature.Location.Latitude,
+		Longitude: testFeature.Location.Longitude,
+	})
+	if err != nil {
+		t.Fatalf("GetFeature: %v", err)
+	}
+	if !proto.Equal(feature, testFeature) {
+		t.Errorf("feature = %v, want %v", feature, testFeature)
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// newTestGRPCWebServer serves the handler of newGRPCWebServer without TLS
+func newTestGRPCWebServer(t *testing.T) *httptest.Server {
+	rs := &server.RouteGuideServerImpl{RouteNotes: make(map[string][]*protos.RouteNote)}
+	rs.SetFeatures([]*protos.Feature{testFeature})
+	grpcServer := grpc.NewServer()
+	protos.RegisterRouteGuideServer(grpcServer, rs)
+	srv := httptest.NewServer(newGRPCWebServer("", []string{allowedOrigin}, nil, grpcServer).Handler)
+	t.Cleanup(func() {
+		srv.Close()
+		grpcServer.Stop()
+	})
+	return srv
+}
+
+// grpcWebFrame is a length prefixed gRPC-Web frame, flags 0 for a message
+func grpcWebFrame(flags byte, msg proto.Message) []byte {
+	data, _ := proto.Marshal(msg)
+	frame := make([]byte, 5, 5+len(data))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+// readGRPCWebResponse splits a gRPC-Web response body into its messages and the trailer frame
+func readGRPCWebResponse(t *testing.T, body io.Reader) ([][]byte, string) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages [][]byte
+	var trailer string
+	for len(data) > 0 {
+		if len(data) < 5 {
+			t.Fatalf("truncated frame header %x", data)
+		}
+		flags, size := data[0], int(binary.BigEndian.Uint32(data[1:5]))
+		if len(data) < 5+size {
+			t.Fatalf("truncated frame, want %d bytes, have %d", size, len(data)-5)
+		}
+		payload := data[5 : 5+size]
+		data = data[5+size:]
+		if flags&0x80 != 0 {
+			trailer = strings.ToLower(string(payload))
+			continue
+		}
+		messages = append(messages, payload)
+	}
+	return messages, trailer
+}
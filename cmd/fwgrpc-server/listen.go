@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unixPrefix marks a listen address as a Unix domain socket path
+const unixPrefix = "unix://"
+
+// listen opens a listener for every comma separated address, either host:port ( IPv6 hosts in
+// brackets ) or unix:///path/to.sock. Sockets are created with socketMode and removed again when
+// their listener is closed, which GracefulStop and Stop do.
+func listen(addresses string, socketMode os.FileMode) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, address := range splitAddresses(addresses) {
+		lis, err := listenOne(address, socketMode)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("%s: %v", address, err)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+// ------ Unexported helpers ------ //
+
+// splitAddresses splits the listen-address flag, dropping empty entries
+func splitAddresses(addresses string) []string {
+	var out []string
+	for _, address := range strings.Split(addresses, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			out = append(out, address)
+		}
+	}
+	return out
+}
+
+// checkAddress validates a single listen address without opening it
+func checkAddress(address string) error {
+	if strings.HasPrefix(address, unixPrefix) {
+		if strings.TrimPrefix(address, unixPrefix) == "" {
+			return fmt.Errorf("%s: missing socket path", address)
+		}
+		return nil
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return fmt.Errorf("%s: %q is not a port number", address, port)
+	}
+	return nil
+}
+
+func listenOne(address string, socketMode os.FileMode) (net.Listener, error) {
+	if !strings.HasPrefix(address, unixPrefix) {
+		return net.Listen("tcp", address)
+	}
+	path := strings.TrimPrefix(address, unixPrefix)
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	// the socket is created with socketMode already, clients can't slip in before the Chmod below
+	var lis net.Listener
+	err := withUmask(int(0777&^socketMode.Perm()), func() (err error) {
+		lis, err = net.Listen("unix", path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the umask can only take permissions away, Chmod also grants what socketMode adds to them
+	if err := os.Chmod(path, socketMode); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
+// removeStaleSocket removes a socket file left behind by a server that was killed,
+// but refuses to touch anything that is not a socket or that another server still answers on
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestListenUnixSocketMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket file modes are a Unix thing")
+	}
+	for _, mode := range []os.FileMode{0600, 0660, 0666} {
+		path := filepath.Join(t.TempDir(), "fwgrpc.sock")
+		listeners, err := listen(unixPrefix+path, mode)
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != mode {
+			t.Errorf("socket mode = %o, want %o", got, mode)
+		}
+		listeners[0].Close()
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("socket still exists after Close: %v", err)
+		}
+	}
+}
+
+func TestListenReplacesOnlyStaleSockets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs Unix domain sockets")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fwgrpc.sock")
+
+	// a socket still answered on belongs to someone else
+	live, err := listen(unixPrefix+path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen(unixPrefix+path, 0600); err == nil {
+		t.Error("listen took over a socket in use")
+	}
+
+	// a killed server leaves its socket behind
+	live[0].(*net.UnixListener).SetUnlinkOnClose(false)
+	live[0].Close()
+	stale, err := listen(unixPrefix+path, 0600)
+	if err != nil {
+		t.Fatalf("listen on a stale socket: %v", err)
+	}
+	stale[0].Close()
+
+	// anything but a socket is left alone
+	regular := filepath.Join(dir, "regular")
+	if err := ioutil.WriteFile(regular, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen(unixPrefix+regular, 0600); err == nil {
+		t.Error("listen replaced a regular file")
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{address: ":10000"},
+		{address: "127.0.0.1:10000"},
+		{address: "[::1]:10000"},
+		{address: "unix:///tmp/fwgrpc.sock"},
+		{address: "unix://", wantErr: true},
+		{address: "localhost", wantErr: true},
+		{address: "::1:10000", wantErr: true},
+		{address: "localhost:http", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := checkAddress(tt.address); (err != nil) != tt.wantErr {
+			t.Errorf("checkAddress(%q) = %v, wantErr %v", tt.address, err, tt.wantErr)
+		}
+	}
+}
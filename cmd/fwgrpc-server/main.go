@@ -1,21 +1,46 @@
 package main
 
 import (
-	"fmt"
+	"crypto/tls"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 
+	"gitlab.com/ethanlewis787/fun-with-grpc/auth"
+	"gitlab.com/ethanlewis787/fun-with-grpc/configfile"
+	"gitlab.com/ethanlewis787/fun-with-grpc/logging"
+	"gitlab.com/ethanlewis787/fun-with-grpc/metrics"
 	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+	"gitlab.com/ethanlewis787/fun-with-grpc/ratelimit"
+	"gitlab.com/ethanlewis787/fun-with-grpc/recovery"
 	"gitlab.com/ethanlewis787/fun-with-grpc/server"
+	"gitlab.com/ethanlewis787/fun-with-grpc/tlsconfig"
+	"gitlab.com/ethanlewis787/fun-with-grpc/tracing"
 
 	"go.uber.org/zap"
 
 	"github.com/urfave/cli"
 )
 
+const (
+	// routeGuideService is the service name health checks can ask about
+	routeGuideService = "protos.RouteGuide"
+	// healthMethodPrefix is exempt from auth so load balancers can check without a token
+	healthMethodPrefix = "/grpc.health.v1.Health/"
+)
+
 func main() {
 	appConfig := &config{}
 	// Init the urfave cli app
@@ -24,6 +49,12 @@ func main() {
 	app.Usage = "cli used to interact with a gRPC server"
 	app.Version = "v0.0.0" // major,minor,patch
 	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:        configfile.FlagName,
+			Usage:       "YAML or TOML settings file, flags and environment variables take precedence over it",
+			EnvVar:      "config",
+			Destination: &appConfig.configFile,
+		},
 		cli.StringFlag{
 			Name:        "port",
 			Value:       "10101", // default value
@@ -31,6 +62,19 @@ func main() {
 			EnvVar:      "port",
 			Destination: &appConfig.gRCPPort,
 		},
+		cli.StringFlag{
+			Name:        "listen-address",
+			Usage:       "comma separated addresses to serve on, host:port, [ipv6]:port or unix:///path, defaults to localhost:<port>",
+			EnvVar:      "listen-address",
+			Destination: &appConfig.listenAddress,
+		},
+		cli.StringFlag{
+			Name:        "unix-socket-mode",
+			Value:       "0660", // default value
+			Usage:       "file mode of unix:// sockets, in octal",
+			EnvVar:      "unix-socket-mode",
+			Destination: &appConfig.unixSocketMode,
+		},
 		cli.StringFlag{
 			Name:        "file-path",
 			Value:       "./testdata/route_guide_db.json", // default value
@@ -38,31 +82,535 @@ func main() {
 			EnvVar:      "file-path",
 			Destination: &appConfig.filePath,
 		},
+		cli.StringFlag{
+			Name:        "distance-mode",
+			Value:       "haversine", // default value
+			Usage:       "distance formula used by RecordRoute (haversine or vincenty)",
+			EnvVar:      "distance-mode",
+			Destination: &appConfig.distanceMode,
+		},
+		cli.IntFlag{
+			Name:        "max-list-results",
+			Value:       server.DefaultMaxListResults, // default value
+			Usage:       "maximum number of features sent by a single ListFeatures call",
+			EnvVar:      "max-list-results",
+			Destination: &appConfig.maxListResults,
+		},
+		cli.StringFlag{
+			Name:        "tls-cert",
+			Usage:       "PEM server certificate, serves TLS when set along with tls-key",
+			EnvVar:      "tls-cert",
+			Destination: &appConfig.tlsCert,
+		},
+		cli.StringFlag{
+			Name:        "tls-key",
+			Usage:       "PEM server private key",
+			EnvVar:      "tls-key",
+			Destination: &appConfig.tlsKey,
+		},
+		cli.StringFlag{
+			Name:        "tls-client-ca",
+			Usage:       "PEM bundle of CAs for client certificates, requires mutual TLS when set",
+			EnvVar:      "tls-client-ca",
+			Destination: &appConfig.tlsClientCA,
+		},
+		cli.StringFlag{
+			Name:        "auth-token-file",
+			Usage:       "file of static bearer tokens, one \"token principal\" pair per line",
+			EnvVar:      "auth-token-file",
+			Destination: &appConfig.authTokenFile,
+		},
+		cli.StringFlag{
+			Name:        "auth-jwks-file",
+			Usage:       "JSON Web Key Set used to verify JWT bearer tokens",
+			EnvVar:      "auth-jwks-file",
+			Destination: &appConfig.authJWKSFile,
+		},
+		cli.StringFlag{
+			Name:        "auth-jwt-issuer",
+			Usage:       "required iss claim of JWT bearer tokens",
+			EnvVar:      "auth-jwt-issuer",
+			Destination: &appConfig.authJWTIssuer,
+		},
+		cli.StringFlag{
+			Name:        "auth-jwt-audience",
+			Usage:       "required aud claim of JWT bearer tokens",
+			EnvVar:      "auth-jwt-audience",
+			Destination: &appConfig.authJWTAudience,
+		},
+		cli.StringFlag{
+			Name:        "auth-policy-file",
+			Usage:       "JSON policy mapping principals to allowed RPCs, everything is allowed when unset",
+			EnvVar:      "auth-policy-file",
+			Destination: &appConfig.authPolicyFile,
+		},
+		cli.BoolFlag{
+			Name:        "reflection",
+			Usage:       "register the gRPC server reflection service, e.g. for grpcurl",
+			EnvVar:      "reflection",
+			Destination: &appConfig.reflection,
+		},
+		cli.DurationFlag{
+			Name:        "shutdown-timeout",
+			Value:       30 * time.Second, // default value
+			Usage:       "how long in-flight RPCs get to finish on SIGTERM/SIGINT before they are cut off",
+			EnvVar:      "shutdown-timeout",
+			Destination: &appConfig.shutdownTimeout,
+		},
+		cli.DurationFlag{
+			Name:        "shutdown-delay",
+			Usage:       "how long to keep serving after reporting NOT_SERVING on SIGTERM/SIGINT, so load balancers stop sending new traffic before the drain starts",
+			EnvVar:      "shutdown-delay",
+			Destination: &appConfig.shutdownDelay,
+		},
+		cli.DurationFlag{
+			Name:        "keepalive-time",
+			Value:       30 * time.Second, // default value
+			Usage:       "ping a client after this long without activity, detects dead peers and keeps NAT mappings open",
+			EnvVar:      "keepalive-time",
+			Destination: &appConfig.keepaliveTime,
+		},
+		cli.DurationFlag{
+			Name:        "keepalive-timeout",
+			Value:       10 * time.Second, // default value
+			Usage:       "close the connection when a keepalive ping is not answered within this long",
+			EnvVar:      "keepalive-timeout",
+			Destination: &appConfig.keepaliveTimeout,
+		},
+		cli.DurationFlag{
+			Name:        "keepalive-min-time",
+			Value:       10 * time.Second, // default value
+			Usage:       "disconnect clients that send keepalive pings more often than this",
+			EnvVar:      "keepalive-min-time",
+			Destination: &appConfig.keepaliveMinTime,
+		},
+		cli.BoolFlag{
+			Name:        "keepalive-permit-without-stream",
+			Usage:       "allow client keepalive pings on connections without open calls",
+			EnvVar:      "keepalive-permit-without-stream",
+			Destination: &appConfig.keepalivePermitWithoutStream,
+		},
+		cli.DurationFlag{
+			Name:        "max-connection-age",
+			Usage:       "ask clients to reconnect after a connection has been open this long, 0 for no limit",
+			EnvVar:      "max-connection-age",
+			Destination: &appConfig.maxConnectionAge,
+		},
+		cli.DurationFlag{
+			Name:        "max-connection-age-grace",
+			Usage:       "time calls get to finish after max-connection-age before the connection is closed, 0 for no limit",
+			EnvVar:      "max-connection-age-grace",
+			Destination: &appConfig.maxConnectionAgeGrace,
+		},
+		cli.IntFlag{
+			Name:        "max-recv-msg-size",
+			Value:       4 << 20, // default value
+			Usage:       "largest message in bytes the server accepts",
+			EnvVar:      "max-recv-msg-size",
+			Destination: &appConfig.maxRecvMsgSize,
+		},
+		cli.IntFlag{
+			Name:        "max-send-msg-size",
+			Value:       4 << 20, // default value
+			Usage:       "largest message in bytes the server sends",
+			EnvVar:      "max-send-msg-size",
+			Destination: &appConfig.maxSendMsgSize,
+		},
+		cli.StringFlag{
+			Name:        "metrics-address",
+			Value:       "localhost:9101", // default value
+			Usage:       "address serving Prometheus metrics on /metrics, empty to disable",
+			EnvVar:      "metrics-address",
+			Destination: &appConfig.metricsAddr,
+		},
+		cli.StringFlag{
+			Name:        "gateway-address",
+			Usage:       "address serving the REST/JSON gateway, over TLS when tls-cert is set, which auth requires, disabled when empty",
+			EnvVar:      "gateway-address",
+			Destination: &appConfig.gatewayAddr,
+		},
+		cli.StringFlag{
+			Name:        "grpc-web-address",
+			Usage:       "address serving gRPC-Web to browsers, over TLS when tls-cert is set, disabled when empty",
+			EnvVar:      "grpc-web-address",
+			Destination: &appConfig.grpcWebAddr,
+		},
+		cli.StringFlag{
+			Name:        "allowed-origins",
+			Usage:       "comma separated browser origins allowed to use the gateway WebSocket and gRPC-Web from other sites, * for any",
+			EnvVar:      "allowed-origins",
+			Destination: &appConfig.allowedOrigins,
+		},
+		cli.StringFlag{
+			Name:        "trace-exporter",
+			Value:       "stdout", // default value
+			Usage:       "where to export trace spans: stdout, file, otlp or none",
+			EnvVar:      "trace-exporter",
+			Destination: &appConfig.traceExporter,
+		},
+		cli.StringFlag{
+			Name:        "trace-file",
+			Value:       "./fwgrpc-server-traces.json", // default value
+			Usage:       "file the file trace exporter appends spans to",
+			EnvVar:      "trace-file",
+			Destination: &appConfig.traceFile,
+		},
+		cli.StringFlag{
+			Name:        "otlp-endpoint",
+			Value:       "localhost:4317", // default value
+			Usage:       "OTLP/gRPC collector address for the otlp trace exporter",
+			EnvVar:      "otlp-endpoint",
+			Destination: &appConfig.otlpEndpoint,
+		},
+		cli.BoolFlag{
+			Name:        "otlp-insecure",
+			Usage:       "send spans to the OTLP collector without TLS",
+			EnvVar:      "otlp-insecure",
+			Destination: &appConfig.otlpInsecure,
+		},
+		cli.IntFlag{
+			Name:        "trace-batch-size",
+			Value:       100, // default value
+			Usage:       "number of streamed messages grouped into one batch span",
+			EnvVar:      "trace-batch-size",
+			Destination: &appConfig.traceBatchSize,
+		},
+		cli.StringFlag{
+			Name:        "log-level",
+			Value:       "info", // default value
+			Usage:       "minimum level logged: debug, info, warn or error",
+			EnvVar:      "log-level",
+			Destination: &appConfig.logLevel,
+		},
+		cli.StringFlag{
+			Name:        "log-format",
+			Value:       "json", // default value
+			Usage:       "log encoding: json or console",
+			EnvVar:      "log-format",
+			Destination: &appConfig.logFormat,
+		},
+		cli.BoolFlag{
+			Name:        "log-sampling",
+			Usage:       "sample repeated log messages under load",
+			EnvVar:      "log-sampling",
+			Destination: &appConfig.logSampling,
+		},
+		cli.StringFlag{
+			Name:        "log-output",
+			Value:       "stderr", // default value
+			Usage:       "where logs are written: stdout, stderr or a file path",
+			EnvVar:      "log-output",
+			Destination: &appConfig.logOutput,
+		},
+		cli.Float64Flag{
+			Name:        "limit-rate",
+			Value:       100, // default value
+			Usage:       "calls per second each client may start, 0 for no limit",
+			EnvVar:      "limit-rate",
+			Destination: &appConfig.limitRate,
+		},
+		cli.IntFlag{
+			Name:        "limit-burst",
+			Value:       200, // default value
+			Usage:       "calls a client may start at once before limit-rate applies",
+			EnvVar:      "limit-burst",
+			Destination: &appConfig.limitBurst,
+		},
+		cli.StringFlag{
+			Name:        "limit-concurrency",
+			Value:       "RouteChat=10,RecordRoute=10,ListFeatures=5", // default value
+			Usage:       "concurrent calls each client may have open per method, as method=limit pairs, * for any method",
+			EnvVar:      "limit-concurrency",
+			Destination: &appConfig.limitConcurrency,
+		},
+		cli.Float64Flag{
+			Name:        "limit-stream-rate",
+			Value:       100, // default value
+			Usage:       "messages per second a client may send on each stream, 0 for no limit",
+			EnvVar:      "limit-stream-rate",
+			Destination: &appConfig.limitStreamRate,
+		},
+		cli.IntFlag{
+			Name:        "limit-stream-burst",
+			Value:       200, // default value
+			Usage:       "messages a client may send at once on a stream before limit-stream-rate applies",
+			EnvVar:      "limit-stream-burst",
+			Destination: &appConfig.limitStreamBurst,
+		},
 	} // defined in flags.go
+	app.Before = func(cliCTX *cli.Context) error {
+		if err := configfile.Load(cliCTX); err != nil {
+			return err
+		}
+		return appConfig.validate()
+	}
+	app.Commands = []cli.Command{
+		configfile.Command(),
+	}
 	// ------- Main Application function -------
 	app.Action = func(cliCTX *cli.Context) error {
 		// Init zap logger
-		zlogger, err := zap.NewDevelopment() // TODO this needs to be configured for production
+		zlogger, err := logging.New(logging.Options{
+			Level:      appConfig.logLevel,
+			Format:     appConfig.logFormat,
+			Sampling:   appConfig.logSampling,
+			OutputPath: appConfig.logOutput,
+		})
 		if err != nil {
 			return err
 		}
+		defer zlogger.Sync()
 		zlogger.Info("creating grpc server")
 
+		shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+			ServiceName:  app.Name,
+			Exporter:     appConfig.traceExporter,
+			FilePath:     appConfig.traceFile,
+			OTLPEndpoint: appConfig.otlpEndpoint,
+			OTLPInsecure: appConfig.otlpInsecure,
+		})
+		if err != nil {
+			zlogger.Error("fail to set up tracing: ", zap.Error(err))
+			return err
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				zlogger.Error("fail to flush traces: ", zap.Error(err))
+			}
+		}()
+
+		distanceMode, err := server.ParseDistanceMode(appConfig.distanceMode)
+		if err != nil {
+			zlogger.Error("invalid distance mode: ", zap.Error(err))
+			return err
+		}
+
+		// the server still starts when the features fail to load, health checks report it as not serving
+		featureStatus := healthpb.HealthCheckResponse_SERVING
 		rs := new(server.RouteGuideServerImpl)
-		rs.LoadFeatures(appConfig.filePath)
+		if err := rs.LoadFeatures(appConfig.filePath); err != nil {
+			zlogger.Error("fail to load features: ", zap.Error(err))
+			featureStatus = healthpb.HealthCheckResponse_NOT_SERVING
+		}
 		rs.RouteNotes = make(map[string][]*protos.RouteNote)
+		rs.DistanceMode = distanceMode
+		rs.MaxListResults = appConfig.maxListResults
 
-		var opts []grpc.ServerOption
-		grpcServer := grpc.NewServer(opts...)
+		// opts are shared with the gateway's internal server, publicOpts only apply to the listeners
+		opts := []grpc.ServerOption{
+			grpc.MaxRecvMsgSize(appConfig.maxRecvMsgSize),
+			grpc.MaxSendMsgSize(appConfig.maxSendMsgSize),
+		}
+		publicOpts := appConfig.connectionOptions()
+		var tlsConfig *tls.Config
+		if appConfig.tlsCert != "" || appConfig.tlsKey != "" {
+			tlsConfig, err = tlsconfig.NewServerConfig(tlsconfig.ServerOptions{
+				CertFile:     appConfig.tlsCert,
+				KeyFile:      appConfig.tlsKey,
+				ClientCAFile: appConfig.tlsClientCA,
+			})
+			if err != nil {
+				zlogger.Error("fail to configure tls: ", zap.Error(err))
+				return err
+			}
+			publicOpts = append(publicOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+			zlogger.Info("tls enabled", zap.Bool("mutual", appConfig.tlsClientCA != ""))
+		}
+		var unaryInterceptors []grpc.UnaryServerInterceptor
+		var streamInterceptors []grpc.StreamServerInterceptor
+		var serverMetrics *metrics.Metrics
+		if appConfig.metricsAddr != "" {
+			// outermost so rejected calls are counted too
+			serverMetrics = metrics.New()
+			serverMetrics.AddGaugeFunc("routeguide_features_loaded", "Features currently loaded.", func() float64 {
+				return float64(rs.FeatureCount())
+			})
+			serverMetrics.AddGaugeFunc("routeguide_route_notes_stored", "RouteNotes stored across all locations.", func() float64 {
+				return float64(rs.RouteNoteCount())
+			})
+			unaryInterceptors = append(unaryInterceptors, serverMetrics.UnaryServerInterceptor())
+			streamInterceptors = append(streamInterceptors, serverMetrics.StreamServerInterceptor())
+		}
+		// logged before auth so rejected calls show up with their request ID
+		unaryInterceptors = append(unaryInterceptors, logging.UnaryServerInterceptor(zlogger))
+		streamInterceptors = append(streamInterceptors, logging.StreamServerInterceptor(zlogger))
+		// a panicking handler only fails its own call, after being logged and counted above
+		var onPanic func(string)
+		if serverMetrics != nil {
+			onPanic = serverMetrics.RecordPanic
+		}
+		unaryInterceptors = append(unaryInterceptors, recovery.UnaryServerInterceptor(zlogger, onPanic))
+		streamInterceptors = append(streamInterceptors, recovery.StreamServerInterceptor(zlogger, onPanic))
+		opts = append(opts, tracing.ServerOption())
+		streamInterceptors = append(streamInterceptors, tracing.StreamServerInterceptor(appConfig.traceBatchSize))
+		if appConfig.authTokenFile != "" || appConfig.authJWKSFile != "" {
+			authenticator, policy, err := loadAuth(appConfig)
+			if err != nil {
+				zlogger.Error("fail to configure auth: ", zap.Error(err))
+				return err
+			}
+			unaryInterceptors = append(unaryInterceptors, auth.UnaryServerInterceptor(authenticator, policy, healthMethodPrefix))
+			streamInterceptors = append(streamInterceptors, auth.StreamServerInterceptor(authenticator, policy, healthMethodPrefix))
+			zlogger.Info("auth enabled", zap.Bool("policy", policy != nil))
+		}
+		// limits come after auth so clients are told apart by principal rather than IP where possible
+		concurrency, err := ratelimit.ParseConcurrency(appConfig.limitConcurrency)
+		if err != nil {
+			zlogger.Error("invalid limit-concurrency: ", zap.Error(err))
+			return err
+		}
+		limiter := ratelimit.New(ratelimit.Options{
+			Rate:          appConfig.limitRate,
+			Burst:         appConfig.limitBurst,
+			MaxConcurrent: concurrency,
+			StreamRate:    appConfig.limitStreamRate,
+			StreamBurst:   appConfig.limitStreamBurst,
+			// the gateway calls over bufconn on behalf of its HTTP clients
+			TrustForwardedFor: func(addr net.Addr) bool {
+				return addr.Network() == "bufconn"
+			},
+		})
+		if serverMetrics != nil {
+			limiter.Register(serverMetrics.Registry)
+		}
+		unaryInterceptors = append(unaryInterceptors, limiter.UnaryServerInterceptor(healthMethodPrefix))
+		streamInterceptors = append(streamInterceptors, limiter.StreamServerInterceptor(healthMethodPrefix))
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(unaryInterceptors...),
+			grpc.ChainStreamInterceptor(streamInterceptors...),
+		)
+		grpcServer := grpc.NewServer(append(publicOpts, opts...)...)
 		protos.RegisterRouteGuideServer(grpcServer, rs)
-		lis, err := net.Listen("tcp", fmt.Sprintf("localhost:%s", appConfig.gRCPPort))
+		healthServer := health.NewServer()
+		healthServer.SetServingStatus("", featureStatus)
+		healthServer.SetServingStatus(routeGuideService, featureStatus)
+		healthpb.RegisterHealthServer(grpcServer, healthServer)
+		if appConfig.reflection {
+			reflection.Register(grpcServer)
+		}
+		socketMode, _ := appConfig.socketMode() // checked by validate
+		listeners, err := listen(appConfig.listenAddresses(), socketMode)
 		if err != nil {
 			zlogger.Error("fail to listen: ", zap.Error(err))
 			return err
 		}
-		zlogger.Info("serving")
-		grpcServer.Serve(lis)
+		var gatewayServer *http.Server
+		var internalServer *grpc.Server
+		if appConfig.gatewayAddr != "" {
+			internalServer = grpc.NewServer(opts...)
+			protos.RegisterRouteGuideServer(internalServer, rs)
+			if gatewayServer, err = newGatewayServer(appConfig.gatewayAddr, splitAddresses(appConfig.allowedOrigins), tlsConfig, internalServer); err != nil {
+				zlogger.Error("fail to start gateway: ", zap.Error(err))
+				return err
+			}
+			go func() {
+				zlogger.Info("serving gateway", zap.String("address", appConfig.gatewayAddr))
+				if err := serveHTTP(gatewayServer); err != nil && err != http.ErrServerClosed {
+					zlogger.Error("fail to serve gateway: ", zap.Error(err))
+				}
+			}()
+		}
+		var grpcWebServer *http.Server
+		if appConfig.grpcWebAddr != "" {
+			grpcWebServer = newGRPCWebServer(appConfig.grpcWebAddr, splitAddresses(appConfig.allowedOrigins), tlsConfig, grpcServer)
+			go func() {
+				zlogger.Info("serving grpc-web", zap.String("address", appConfig.grpcWebAddr))
+				if err := serveHTTP(grpcWebServer); err != nil && err != http.ErrServerClosed {
+					zlogger.Error("fail to serve grpc-web: ", zap.Error(err))
+				}
+			}()
+		}
+		var metricsServer *http.Server
+		if serverMetrics != nil {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", serverMetrics.Handler())
+			metricsServer = &http.Server{Addr: appConfig.metricsAddr, Handler: mux}
+			go func() {
+				zlogger.Info("serving metrics", zap.String("address", appConfig.metricsAddr))
+				if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					zlogger.Error("fail to serve metrics: ", zap.Error(err))
+				}
+			}()
+		}
 
+		// shut down gracefully on SIGTERM/SIGINT
+		stopped := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		go func() {
+			defer close(stopped)
+			sig := <-signals
+			zlogger.Info("shutting down", zap.Stringer("signal", sig), zap.Duration("delay", appConfig.shutdownDelay),
+				zap.Duration("timeout", appConfig.shutdownTimeout))
+			// stop new traffic arriving first, then wind down the streams that never end on their own
+			healthServer.Shutdown()
+			if appConfig.shutdownDelay > 0 {
+				// keep serving until load balancers have seen NOT_SERVING, a second signal cuts it short
+				select {
+				case <-time.After(appConfig.shutdownDelay):
+				case sig := <-signals:
+					zlogger.Info("skipping shutdown delay", zap.Stringer("signal", sig))
+				}
+			}
+			rs.Drain()
+			graceful := make(chan struct{})
+			go func() {
+				// the gateway goes first, its requests are calls on the internal server
+				if gatewayServer != nil {
+					gatewayServer.Shutdown(context.Background())
+					internalServer.GracefulStop()
+				}
+				if grpcWebServer != nil {
+					grpcWebServer.Shutdown(context.Background())
+				}
+				grpcServer.GracefulStop()
+				close(graceful)
+			}()
+			select {
+			case <-graceful:
+				zlogger.Info("drained")
+			case <-time.After(appConfig.shutdownTimeout):
+				zlogger.Warn("shutdown timeout exceeded, closing remaining connections")
+				if gatewayServer != nil {
+					gatewayServer.Close()
+					internalServer.Stop()
+				}
+				if grpcWebServer != nil {
+					grpcWebServer.Close()
+				}
+				grpcServer.Stop()
+			}
+			// keep metrics up until the very end so the drain can be watched
+			if metricsServer != nil {
+				metricsServer.Close()
+			}
+		}()
+
+		serveErrs := make(chan error, len(listeners))
+		for _, lis := range listeners {
+			zlogger.Info("serving", zap.String("address", lis.Addr().Network()+":"+lis.Addr().String()))
+			go func(lis net.Listener) {
+				serveErrs <- grpcServer.Serve(lis)
+			}(lis)
+		}
+		for range listeners {
+			if err := <-serveErrs; err != nil {
+				// one broken listener takes the others down with it, closing them removes their sockets
+				zlogger.Error("fail to serve: ", zap.Error(err))
+				if gatewayServer != nil {
+					gatewayServer.Close()
+					internalServer.Stop()
+				}
+				if grpcWebServer != nil {
+					grpcWebServer.Close()
+				}
+				grpcServer.Stop()
+				return err
+			}
+		}
+		// Serve returns as soon as shutdown starts, wait for in-flight RPCs
+		<-stopped
+		zlogger.Info("server stopped")
 		return nil
 	}
 	// Start main
@@ -70,3 +618,32 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// loadAuth builds the authenticator and policy from the auth flags
+func loadAuth(appConfig *config) (auth.Authenticator, *auth.Policy, error) {
+	var chain auth.Chain
+	if appConfig.authTokenFile != "" {
+		tokens, err := auth.LoadTokenFile(appConfig.authTokenFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, tokens)
+	}
+	if appConfig.authJWKSFile != "" {
+		verifier, err := auth.LoadJWKSFile(appConfig.authJWKSFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		verifier.Issuer = appConfig.authJWTIssuer
+		verifier.Audience = appConfig.authJWTAudience
+		chain = append(chain, verifier)
+	}
+	var policy *auth.Policy
+	if appConfig.authPolicyFile != "" {
+		var err error
+		if policy, err = auth.LoadPolicyFile(appConfig.authPolicyFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	return chain, policy, nil
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "syscall"
+
+// withUmask runs fn with the process umask set to mask. The umask is process wide, listen runs
+// before anything else that creates files is started.
+func withUmask(mask int, fn func() error) error {
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	return fn()
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestWithUmaskRestoresUmask(t *testing.T) {
+	before := syscall.Umask(022)
+	defer syscall.Umask(before)
+
+	var during int
+	withUmask(0177, func() error {
+		during = syscall.Umask(0177)
+		return nil
+	})
+	if during != 0177 {
+		t.Errorf("umask inside withUmask = %o, want 177", during)
+	}
+	if after := syscall.Umask(022); after != 022 {
+		t.Errorf("umask after withUmask = %o, want it restored to 22", after)
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+// withUmask runs fn, Windows has no umask and guards sockets with the directory's ACL
+func withUmask(mask int, fn func() error) error {
+	return fn()
+}
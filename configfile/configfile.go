@@ -0,0 +1,196 @@
+// Package configfile layers a YAML or TOML settings file under the command line flags and
+// environment variables of a cli app. Keys are the flag names, tables group them:
+//
+//	port: "10101"
+//	tls:
+//	  cert: server.pem   # same as tls-cert
+//	  key: server.key
+//
+// A flag given on the command line or through its environment variable always wins over the file.
+package configfile
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// FlagName is the global flag holding the path of the settings file
+const FlagName = "config"
+
+// Load applies the settings file named by the config flag to every global flag not set
+// on the command line or in the environment. Call it from the app's Before func.
+// Unknown keys are an error so a typo does not silently leave a setting at its default.
+func Load(cliCTX *cli.Context) error {
+	path := cliCTX.GlobalString(FlagName)
+	if path == "" {
+		return nil
+	}
+	values, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, name := range flagNames(cliCTX.App.Flags) {
+		known[name] = true
+	}
+	// work out what the file may set before setting anything, every flag looks set afterwards
+	var keys []string
+	for key := range values {
+		if !known[key] || key == FlagName {
+			return fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+		if !cliCTX.GlobalIsSet(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := cliCTX.GlobalSet(key, values[key]); err != nil {
+			return fmt.Errorf("%s: %s: %v", path, key, err)
+		}
+	}
+	return nil
+}
+
+// Command is the "config print" command, it prints the effective settings once flags, environment
+// variables and the settings file are merged, as YAML that can be used as a settings file.
+// The values of the secret flags are masked.
+func Command(secret ...string) cli.Command {
+	return cli.Command{
+		Name:  "config",
+		Usage: "inspect the configuration",
+		Subcommands: []cli.Command{
+			{
+				Name:  "print",
+				Usage: "print the effective configuration",
+				Action: func(cliCTX *cli.Context) error {
+					return printSettings(os.Stdout, cliCTX, secret)
+				},
+			},
+		},
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// readFile reads a settings file into flag name, flag value pairs, the format follows the extension
+func readFile(path string) (map[string]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &tree)
+	case ".toml":
+		_, err = toml.Decode(string(raw), &tree)
+	default:
+		return nil, fmt.Errorf("%s: settings files must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	values := make(map[string]string)
+	if err := flatten("", tree, values); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return values, nil
+}
+
+// flatten turns nested tables into dash separated keys, tls.cert becomes tls-cert
+func flatten(prefix string, tree map[string]interface{}, values map[string]string) error {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "-" + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(key, v, values); err != nil {
+				return err
+			}
+		case map[interface{}]interface{}:
+			// yaml.v2 decodes nested mappings with interface keys
+			table := make(map[string]interface{}, len(v))
+			for k, vv := range v {
+				table[fmt.Sprint(k)] = vv
+			}
+			if err := flatten(key, table, values); err != nil {
+				return err
+			}
+		case []interface{}:
+			return fmt.Errorf("%s: lists are not supported", key)
+		case nil:
+			// an empty key leaves the flag alone
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// flagNames lists the first name of every flag, skipping the built in help and version flags
+func flagNames(flags []cli.Flag) []string {
+	var names []string
+	for _, f := range flags {
+		name := strings.TrimSpace(strings.Split(f.GetName(), ",")[0])
+		if name == "help" || name == "version" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func printSettings(w io.Writer, cliCTX *cli.Context, secret []string) error {
+	var settings yaml.MapSlice
+	// subcommands run as apps of their own, the global flags live on the outermost one
+	root := cliCTX
+	for root.Parent() != nil {
+		root = root.Parent()
+	}
+	for _, name := range flagNames(root.App.Flags) {
+		if name == FlagName {
+			continue
+		}
+		var value interface{}
+		if getter, ok := cliCTX.GlobalGeneric(name).(flag.Getter); ok {
+			value = getter.Get()
+		}
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case string:
+			if v != "" && isSecret(name, secret) {
+				value = "<redacted>"
+			}
+		}
+		settings = append(settings, yaml.MapItem{Key: name, Value: value})
+	}
+	out, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+func isSecret(name string, secret []string) bool {
+	for _, s := range secret {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package configfile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// settings are the flag values the test app ends up with
+type settings struct {
+	port          string
+	tlsCert       string
+	tlsKey        string
+	limitRate     float64
+	keepaliveTime time.Duration
+	verbose       bool
+}
+
+func TestLoadNestedTables(t *testing.T) {
+	files := map[string]string{
+		"settings.yaml": `
+port: "10102"
+tls:
+  cert: server.pem
+  key: server-key.pem
+limit:
+  rate: 2.5
+keepalive:
+  time: 1m
+verbose: true
+`,
+		"settings.toml": `
+port = "10102"
+verbose = true
+
+[tls]
+cert = "server.pem"
+key = "server-key.pem"
+
+[limit]
+rate = 2.5
+
+[keepalive]
+time = "1m"
+`,
+	}
+	want := settings{
+		port:          "10102",
+		tlsCert:       "server.pem",
+		tlsKey:        "server-key.pem",
+		limitRate:     2.5,
+		keepaliveTime: time.Minute,
+		verbose:       true,
+	}
+	for name, file := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeFile(t, name, file)
+			got, err := run(t, "--config", path)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if got != want {
+				t.Errorf("settings = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// A flag on the command line beats its environment variable, which beats the file.
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "settings.yaml", "port: \"1001\"\ntls:\n  cert: file.pem\n  key: file-key.pem\n")
+	t.Setenv("TEST_PORT", "2002")
+	t.Setenv("TEST_TLS_CERT", "env.pem")
+	got, err := run(t, "--config", path, "--port", "3003")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got.port != "3003" {
+		t.Errorf("port = %q, want the command line's 3003", got.port)
+	}
+	if got.tlsCert != "env.pem" {
+		t.Errorf("tls-cert = %q, want the environment's env.pem", got.tlsCert)
+	}
+	if got.tlsKey != "file-key.pem" {
+		t.Errorf("tls-key = %q, want the file's file-key.pem", got.tlsKey)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown key", file: "settings.yaml", content: "prot: 1\n", wantErr: `unknown setting "prot"`},
+		{name: "unknown nested key", file: "settings.toml", content: "[tls]\ncer = \"server.pem\"\n", wantErr: `unknown setting "tls-cer"`},
+		{name: "the config flag itself", file: "settings.yaml", content: "config: other.yaml\n", wantErr: `unknown setting "config"`},
+		{name: "list", file: "settings.yaml", content: "port:\n  - 1\n  - 2\n", wantErr: "lists are not supported"},
+		{name: "bad value", file: "settings.yaml", content: "keepalive:\n  time: soon\n", wantErr: "keepalive-time"},
+		{name: "bad syntax", file: "settings.toml", content: "port = \n", wantErr: "settings.toml"},
+		{name: "unknown format", file: "settings.json", content: `{"port": "1"}`, wantErr: "must end in .yaml, .yml or .toml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := run(t, "--config", writeFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("run = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// config print shows the merged settings as a settings file, with secrets masked.
+func TestPrintSettings(t *testing.T) {
+	path := writeFile(t, "settings.yaml", "port: \"1001\"\nauth:\n  token: s3cr3t\n")
+	var out bytes.Buffer
+	app := newApp(&settings{})
+	app.Commands = []cli.Command{{
+		Name: "print",
+		Action: func(cliCTX *cli.Context) error {
+			return printSettings(&out, cliCTX, []string{"auth-token", "tls-key"})
+		},
+	}}
+	if err := app.Run([]string{"test", "--config", path, "--verbose", "print"}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	var printed map[string]interface{}
+	if err := yaml.Unmarshal(out.Bytes(), &printed); err != nil {
+		t.Fatalf("printed settings are not YAML: %v\n%s", err, out.String())
+	}
+	want := map[string]interface{}{
+		"port":           "1001",
+		"auth-token":     "<redacted>",
+		"verbose":        true,
+		"keepalive-time": "30s",
+		// an empty secret has nothing to hide
+		"tls-key": "",
+	}
+	for key, value := range want {
+		if printed[key] != value {
+			t.Errorf("%s = %#v, want %#v", key, printed[key], value)
+		}
+	}
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("the token was printed:\n%s", out.String())
+	}
+	if _, ok := printed[FlagName]; ok {
+		t.Error("the config flag was printed")
+	}
+
+	// the printed settings load back into the same values
+	reloaded, err := run(t, "--config", writeFile(t, "printed.yaml", strings.Replace(out.String(), "<redacted>", "x", 1)))
+	if err != nil {
+		t.Fatalf("loading the printed settings: %v", err)
+	}
+	if reloaded.port != "1001" || !reloaded.verbose {
+		t.Errorf("reloaded settings = %+v", reloaded)
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// newApp builds an app with a few flags of every kind, bound to s
+func newApp(s *settings) *cli.App {
+	var token string
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: FlagName},
+		cli.StringFlag{Name: "port", Value: "10101", EnvVar: "TEST_PORT", Destination: &s.port},
+		cli.StringFlag{Name: "tls-cert", EnvVar: "TEST_TLS_CERT", Destination: &s.tlsCert},
+		cli.StringFlag{Name: "tls-key", Destination: &s.tlsKey},
+		cli.StringFlag{Name: "auth-token", Destination: &token},
+		cli.Float64Flag{Name: "limit-rate", Value: 100, Destination: &s.limitRate},
+		cli.DurationFlag{Name: "keepalive-time", Value: 30 * time.Second, Destination: &s.keepaliveTime},
+		cli.BoolFlag{Name: "verbose", Destination: &s.verbose},
+	}
+	app.Before = Load
+	app.Action = func(cliCTX *cli.Context) error { return nil }
+	return app
+}
+
+// run runs the test app with args and returns the settings it ended up with
+func run(t *testing.T, args ...string) (settings, error) {
+	var s settings
+	err := newApp(&s).Run(append([]string{"test"}, args...))
+	return s, err
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
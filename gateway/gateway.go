@@ -0,0 +1,315 @@
+// Package gateway serves the RouteGuide service as REST/JSON for clients that can't speak gRPC.
+// Every request is turned into an RPC on a RouteGuideClient, so the server's interceptors
+// (auth, limits, logging, metrics) apply to gateway traffic as well. Messages use the
+// protobuf JSON mapping:
+//
+//	GET  /features?lat=409146138&lng=-746188906        GetFeature
+//	GET  /features:list?lo_lat=..&lo_lng=..&hi_lat=..&hi_lng=..   ListFeatures, as NDJSON
+//	POST /routes  [{"latitude": 1, "longitude": 2}, ...]   RecordRoute
+//	GET  /routechat  WebSocket of RouteNotes              RouteChat
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/pagetoken"
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+const (
+	// these HTTP headers are copied onto the RPC
+	authorizationHeader = "authorization"
+	requestIDHeader     = "x-request-id"
+	// forwardedForMetadata tells the server's rate limiter who the gateway calls for
+	forwardedForMetadata = "x-forwarded-for"
+)
+
+// Gateway is an http.Handler for the RouteGuide REST routes
+type Gateway struct {
+	// AllowedOrigins are the browser origins, besides the gateway's own, that may open a
+	// WebSocket, e.g. https://maps.example.com. "*" allows any origin.
+	AllowedOrigins []string
+
+	client protos.RouteGuideClient
+	mux    *http.ServeMux
+}
+
+// New creates a Gateway calling client
+func New(client protos.RouteGuideClient) *Gateway {
+	g := &Gateway{client: client, mux: http.NewServeMux()}
+	g.mux.HandleFunc("/features", g.getFeature)
+	g.mux.HandleFunc("/features:list", g.listFeatures)
+	g.mux.HandleFunc("/routes", g.recordRoute)
+	g.mux.HandleFunc("/routechat", g.routeChat)
+	return g
+}
+
+// ServeHTTP implements http.Handler
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// HTTPStatusFromCode maps a gRPC status code to the closest HTTP status
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // client closed request
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// OriginAllowed checks a browser origin against a list of allowed origins, where "*" allows any
+func OriginAllowed(origin string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(a, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// ------ Unexported helpers ------ //
+
+func (g *Gateway) getFeature(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, status.Errorf(codes.Unimplemented, "%s %s is not supported", r.Method, r.URL.Path))
+		return
+	}
+	q := r.URL.Query()
+	req := &protos.GetFeatureRequest{ReadMask: readMask(q.Get("fields"))}
+	var err error
+	if req.Latitude, err = int32Param(q.Get("lat"), "lat", true); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Longitude, err = int32Param(q.Get("lng"), "lng", true); err != nil {
+		writeError(w, err)
+		return
+	}
+	feature, err := g.client.GetFeature(outgoingContext(r), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, feature)
+}
+
+// listFeatures streams the features as newline delimited JSON. An error after the first
+// feature can't change the HTTP status any more, it is sent as a final {"error": ...} line.
+// The page token for the next call is sent in the Next-Page-Token trailer.
+func (g *Gateway) listFeatures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, status.Errorf(codes.Unimplemented, "%s %s is not supported", r.Method, r.URL.Path))
+		return
+	}
+	q := r.URL.Query()
+	req := &protos.ListFeaturesRequest{
+		Lo:        &protos.Point{},
+		Hi:        &protos.Point{},
+		PageToken: q.Get("page_token"),
+		ReadMask:  readMask(q.Get("fields")),
+	}
+	params := []struct {
+		name string
+		dst  *int32
+	}{
+		{"lo_lat", &req.Lo.Latitude},
+		{"lo_lng", &req.Lo.Longitude},
+		{"hi_lat", &req.Hi.Latitude},
+		{"hi_lng", &req.Hi.Longitude},
+		{"max_results", &req.MaxResults},
+	}
+	for _, p := range params {
+		v, err := int32Param(q.Get(p.name), p.name, p.name != "max_results")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		*p.dst = v
+	}
+	if tags, category := q["tag"], q.Get("category"); len(tags) > 0 || category != "" {
+		req.Filter = &protos.FeatureFilter{Tags: tags, Category: category}
+	}
+
+	stream, err := g.client.ListFeatures(outgoingContext(r), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	marshaler := jsonpb.Marshaler{}
+	flusher, _ := w.(http.Flusher)
+	sent := 0
+	for {
+		feature, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if sent == 0 {
+				writeError(w, err)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": errorBody(err)})
+			return
+		}
+		if sent == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Trailer", "Next-Page-Token, Truncated")
+		}
+		if err := marshaler.Marshal(w, feature); err != nil {
+			return
+		}
+		io.WriteString(w, "\n")
+		if flusher != nil {
+			flusher.Flush()
+		}
+		sent++
+	}
+	if sent == 0 {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Trailer", "Next-Page-Token, Truncated")
+		w.WriteHeader(http.StatusOK)
+	}
+	trailer := stream.Trailer()
+	if vals := trailer.Get(pagetoken.NextPageTokenTrailer); len(vals) > 0 {
+		w.Header().Set("Next-Page-Token", vals[0])
+	}
+	if vals := trailer.Get(pagetoken.TruncatedTrailer); len(vals) > 0 {
+		w.Header().Set("Truncated", vals[0])
+	}
+}
+
+// recordRoute sends a JSON array of points as one RecordRoute call and answers with the RouteSummary
+func (g *Gateway) recordRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, status.Errorf(codes.Unimplemented, "%s %s is not supported", r.Method, r.URL.Path))
+		return
+	}
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeError(w, status.Errorf(codes.InvalidArgument, "body must be a JSON array of points: %v", err))
+		return
+	}
+	points := make([]*protos.Point, len(raw))
+	for i, msg := range raw {
+		points[i] = &protos.Point{}
+		if err := jsonpb.UnmarshalString(string(msg), points[i]); err != nil {
+			writeError(w, status.Errorf(codes.InvalidArgument, "point %d: %v", i, err))
+			return
+		}
+	}
+
+	stream, err := g.client.RecordRoute(outgoingContext(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for _, point := range points {
+		if err := stream.Send(point); err != nil {
+			// the real error is only known once the stream is closed
+			break
+		}
+	}
+	summary, err := stream.CloseAndRecv()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, summary)
+}
+
+// outgoingContext forwards the caller's credentials, request ID and IP address to the RPC.
+// The IP address is the HTTP peer's, an X-Forwarded-For header sent by the caller is not trusted.
+func outgoingContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	var pairs []string
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		pairs = append(pairs, forwardedForMetadata, host)
+	}
+	if v := r.Header.Get(authorizationHeader); v != "" {
+		pairs = append(pairs, authorizationHeader, v)
+	}
+	if v := r.Header.Get(requestIDHeader); v != "" {
+		pairs = append(pairs, requestIDHeader, v)
+	}
+	if len(pairs) == 0 {
+		return ctx
+	}
+	return metadata.NewOutgoingContext(ctx, metadata.Pairs(pairs...))
+}
+
+// int32Param parses a query parameter, a missing optional parameter is 0
+func int32Param(value, name string, required bool) (int32, error) {
+	if value == "" {
+		if required {
+			return 0, status.Errorf(codes.InvalidArgument, "missing %s parameter", name)
+		}
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "%s: %q is not a 32 bit integer", name, value)
+	}
+	return int32(v), nil
+}
+
+// readMask turns fields=name,location into a FieldMask, nil when fields is empty
+func readMask(fields string) *field_mask.FieldMask {
+	if fields == "" {
+		return nil
+	}
+	return &field_mask.FieldMask{Paths: strings.Split(fields, ",")}
+}
+
+func writeMessage(w http.ResponseWriter, msg proto.Message) {
+	w.Header().Set("Content-Type", "application/json")
+	marshaler := jsonpb.Marshaler{}
+	marshaler.Marshal(w, msg)
+}
+
+// writeError answers with the HTTP status matching err's gRPC code and a {"code", "message"} body
+func writeError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatusFromCode(status.Code(err)))
+	json.NewEncoder(w).Encode(errorBody(err))
+}
+
+func errorBody(err error) map[string]interface{} {
+	st := status.Convert(err)
+	return map[string]interface{}{"code": int(st.Code()), "message": st.Message()}
+}
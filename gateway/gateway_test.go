@@ -0,0 +1,328 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+func TestGetFeature(t *testing.T) {
+	gw, rs := newTestGateway(t)
+	rs.SetFeatures([]*protos.Feature{
+		{Name: "Patriots Path", Location: &protos.Point{Latitude: 409146138, Longitude: -746188906}, Category: "park"},
+	})
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       *protos.Feature
+	}{
+		{
+			name:       "found",
+			query:      "lat=409146138&lng=-746188906",
+			wantStatus: http.StatusOK,
+			want:       &protos.Feature{Name: "Patriots Path", Location: &protos.Point{Latitude: 409146138, Longitude: -746188906}, Category: "park"},
+		},
+		{name: "fields", query: "lat=409146138&lng=-746188906&fields=name", wantStatus: http.StatusOK, want: &protos.Feature{Name: "Patriots Path"}},
+		{name: "missing lat", query: "lng=-746188906", wantStatus: http.StatusBadRequest},
+		{name: "bad lat", query: "lat=north&lng=-746188906", wantStatus: http.StatusBadRequest},
+		{name: "lat out of range", query: "lat=9999999999&lng=-746188906", wantStatus: http.StatusBadRequest},
+		{name: "unknown field", query: "lat=1&lng=2&fields=rating", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get(t, gw.URL+"/features?"+tt.query, testToken)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.want == nil {
+				expectErrorBody(t, body, codes.InvalidArgument)
+				return
+			}
+			got := &protos.Feature{}
+			if err := jsonpb.UnmarshalString(body, got); err != nil {
+				t.Fatalf("body %s is not a Feature: %v", body, err)
+			}
+			if !proto.Equal(got, tt.want) {
+				t.Errorf("feature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	resp, body := get(t, gw.URL+"/features?lat=1&lng=2", "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status without a token = %d, want %d: %s", resp.StatusCode, http.StatusUnauthorized, body)
+	}
+}
+
+func TestGetFeatureNotFound(t *testing.T) {
+	gw := httptest.NewServer(New(&fakeRouteGuide{err: status.Errorf(codes.NotFound, "nothing at 1,2")}))
+	defer gw.Close()
+	resp, body := get(t, gw.URL+"/features?lat=1&lng=2", "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	expectErrorBody(t, body, codes.NotFound)
+}
+
+// Features are streamed one JSON object per line, the page token and truncation come last as
+// HTTP trailers.
+func TestListFeaturesNDJSON(t *testing.T) {
+	gw, rs := newTestGateway(t)
+	rs.MaxListResults = 2
+	rs.SetFeatures([]*protos.Feature{
+		{Name: "one", Location: &protos.Point{Latitude: 1, Longitude: 1}},
+		{Name: "two", Location: &protos.Point{Latitude: 2, Longitude: 2}},
+		{Name: "three", Location: &protos.Point{Latitude: 3, Longitude: 3}},
+	})
+	resp, body := get(t, gw.URL+"/features:list?lo_lat=0&lo_lng=0&hi_lat=10&hi_lng=10", testToken)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+	}
+	if got := ndjsonNames(t, body); strings.Join(got, ",") != "one,two" {
+		t.Errorf("features = %q, want one and two", got)
+	}
+	token := resp.Trailer.Get("Next-Page-Token")
+	if token == "" {
+		t.Fatal("no Next-Page-Token trailer")
+	}
+	if truncated := resp.Trailer.Get("Truncated"); truncated != "true" {
+		t.Errorf("Truncated trailer = %q, want true", truncated)
+	}
+
+	resp, body = get(t, gw.URL+"/features:list?lo_lat=0&lo_lng=0&hi_lat=10&hi_lng=10&page_token="+token, testToken)
+	if got := ndjsonNames(t, body); strings.Join(got, ",") != "three" {
+		t.Errorf("second page = %q, want three", got)
+	}
+	if token := resp.Trailer.Get("Next-Page-Token"); token != "" {
+		t.Errorf("Next-Page-Token = %q on the last page", token)
+	}
+
+	resp, body = get(t, gw.URL+"/features:list?lo_lat=0&lo_lng=0&hi_lat=10&hi_lng=10&page_token=%25%25", testToken)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status for a bad page token = %d, want %d: %s", resp.StatusCode, http.StatusBadRequest, body)
+	}
+	resp, body = get(t, gw.URL+"/features:list?lo_lat=0&lo_lng=0&hi_lat=10", testToken)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status without hi_lng = %d, want %d: %s", resp.StatusCode, http.StatusBadRequest, body)
+	}
+}
+
+// Once a feature went out the status is 200, a failure after it ends the body with an error line.
+func TestListFeaturesFailsMidStream(t *testing.T) {
+	fake := &fakeRouteGuide{
+		features: []*protos.Feature{{Name: "one"}},
+		err:      status.Errorf(codes.Unavailable, "server is shutting down"),
+	}
+	gw := httptest.NewServer(New(fake))
+	defer gw.Close()
+	resp, body := get(t, gw.URL+"/features:list?lo_lat=0&lo_lng=0&hi_lat=10&hi_lng=10", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("body has %d lines, want a feature and an error: %s", len(lines), body)
+	}
+	var last struct {
+		Error struct {
+			Code    codes.Code `json:"code"`
+			Message string     `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &last); err != nil {
+		t.Fatalf("last line %s: %v", lines[1], err)
+	}
+	if last.Error.Code != codes.Unavailable || last.Error.Message != "server is shutting down" {
+		t.Errorf("error line = %s, want Unavailable", lines[1])
+	}
+
+	// failing before the first feature still picks the HTTP status
+	fake.features = nil
+	resp, body = get(t, gw.URL+"/features:list?lo_lat=0&lo_lng=0&hi_lat=10&hi_lng=10", "")
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	expectErrorBody(t, body, codes.Unavailable)
+}
+
+func TestRecordRoute(t *testing.T) {
+	gw, _ := newTestGateway(t)
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "route", body: `[{"latitude": 1, "longitude": 2}, {"latitude": 3, "longitude": 4}]`, wantStatus: http.StatusOK},
+		{name: "not JSON", body: `latitude=1`, wantStatus: http.StatusBadRequest},
+		{name: "not an array", body: `{"latitude": 1, "longitude": 2}`, wantStatus: http.StatusBadRequest},
+		{name: "bad point", body: `[{"latitude": "north"}]`, wantStatus: http.StatusBadRequest},
+		{name: "unknown point field", body: `[{"altitude": 1}]`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, gw.URL+"/routes", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			resp, body := do(t, req)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				expectErrorBody(t, body, codes.InvalidArgument)
+				return
+			}
+			summary := &protos.RouteSummary{}
+			if err := jsonpb.UnmarshalString(body, summary); err != nil {
+				t.Fatalf("body %s is not a RouteSummary: %v", body, err)
+			}
+			if summary.PointCount != 2 {
+				t.Errorf("point_count = %d, want 2", summary.PointCount)
+			}
+		})
+	}
+
+	resp, _ := get(t, gw.URL+"/routes", testToken)
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("GET /routes = %d, want %d", resp.StatusCode, http.StatusNotImplemented)
+	}
+}
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	tests := map[codes.Code]int{
+		codes.OK:                 http.StatusOK,
+		codes.Canceled:           499,
+		codes.Unknown:            http.StatusInternalServerError,
+		codes.InvalidArgument:    http.StatusBadRequest,
+		codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+		codes.NotFound:           http.StatusNotFound,
+		codes.AlreadyExists:      http.StatusConflict,
+		codes.PermissionDenied:   http.StatusForbidden,
+		codes.ResourceExhausted:  http.StatusTooManyRequests,
+		codes.FailedPrecondition: http.StatusBadRequest,
+		codes.Aborted:            http.StatusConflict,
+		codes.OutOfRange:         http.StatusBadRequest,
+		codes.Unimplemented:      http.StatusNotImplemented,
+		codes.Internal:           http.StatusInternalServerError,
+		codes.Unavailable:        http.StatusServiceUnavailable,
+		codes.DataLoss:           http.StatusInternalServerError,
+		codes.Unauthenticated:    http.StatusUnauthorized,
+	}
+	for code, want := range tests {
+		if got := HTTPStatusFromCode(code); got != want {
+			t.Errorf("HTTPStatusFromCode(%s) = %d, want %d", code, got, want)
+		}
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// get sends a GET with token as the bearer token, when set, and returns the response and its
+// whole body, so the trailers are in
+func get(t *testing.T, url, token string) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return do(t, req)
+}
+
+func do(t *testing.T, req *http.Request) (*http.Response, string) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+// expectErrorBody checks body is the {"code", "message"} writeError sends
+func expectErrorBody(t *testing.T, body string, want codes.Code) {
+	t.Helper()
+	var e struct {
+		Code    codes.Code `json:"code"`
+		Message string     `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(body), &e); err != nil {
+		t.Fatalf("error body %s: %v", body, err)
+	}
+	if e.Code != want || e.Message == "" {
+		t.Errorf("error body = %s, want code %d and a message", body, want)
+	}
+}
+
+// ndjsonNames reads one Feature per line and returns their names
+func ndjsonNames(t *testing.T, body string) []string {
+	var names []string
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		feature := &protos.Feature{}
+		if err := jsonpb.UnmarshalString(scanner.Text(), feature); err != nil {
+			t.Fatalf("line %s is not a Feature: %v", scanner.Text(), err)
+		}
+		names = append(names, feature.Name)
+	}
+	return names
+}
+
+// fakeRouteGuide fails GetFeature with err, ListFeatures sends features and then fails with err
+type fakeRouteGuide struct {
+	protos.RouteGuideClient
+	features []*protos.Feature
+	err      error
+}
+
+func (f *fakeRouteGuide) GetFeature(ctx context.Context, req *protos.GetFeatureRequest, opts ...grpc.CallOption) (*protos.Feature, error) {
+	return nil, f.err
+}
+
+func (f *fakeRouteGuide) ListFeatures(ctx context.Context, req *protos.ListFeaturesRequest, opts ...grpc.CallOption) (protos.RouteGuide_ListFeaturesClient, error) {
+	return &fakeListStream{features: f.features, err: f.err}, nil
+}
+
+type fakeListStream struct {
+	grpc.ClientStream
+	features []*protos.Feature
+	err      error
+}
+
+func (s *fakeListStream) Recv() (*protos.Feature, error) {
+	if len(s.features) == 0 {
+		return nil, s.err
+	}
+	feature := s.features[0]
+	s.features = s.features[1:]
+	return feature, nil
+}
+
+func (s *fakeListStream) Trailer() metadata.MD {
+	return nil
+}
@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/gorilla/websocket"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+const (
+	// closeCodeBase is added to the gRPC code of a failed chat, e.g. 4007 for PermissionDenied.
+	// 4000-4999 is the range RFC 6455 leaves to applications.
+	closeCodeBase = 4000
+	// maxCloseReason is the longest reason that fits in a close frame
+	maxCloseReason = 123
+	// closeWriteTimeout bounds how long a close frame may take to send
+	closeWriteTimeout = time.Second
+	// accessTokenParam carries the bearer token of browsers, which can't set headers on a WebSocket
+	accessTokenParam = "access_token"
+)
+
+// CloseCodeFromStatus maps the gRPC code a RouteChat ended with to a WebSocket close code:
+// 1000 for OK, 4000 plus the gRPC code otherwise.
+func CloseCodeFromStatus(code codes.Code) int {
+	if code == codes.OK {
+		return websocket.CloseNormalClosure
+	}
+	return closeCodeBase + int(code)
+}
+
+// ------ Unexported helpers ------ //
+
+// routeChat bridges a WebSocket to a RouteChat call. Every text or binary frame from the browser is a
+// RouteNote in JSON, every note the server sends back is written as a text frame. The call ends when
+// either side closes, the close frame sent to the browser carries the RPC's status, see CloseCodeFromStatus.
+// The token is read from the Authorization header or the access_token query parameter.
+func (g *Gateway) routeChat(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: g.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has answered with an HTTP error already
+		return
+	}
+	defer conn.Close()
+
+	ctx := outgoingContext(r)
+	if token := r.URL.Query().Get(accessTokenParam); token != "" && r.Header.Get(authorizationHeader) == "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, authorizationHeader, "Bearer "+token)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := g.client.RouteChat(ctx)
+	if err != nil {
+		writeClose(conn, err)
+		return
+	}
+
+	// browser to server, a clean close from the browser ends our side of the chat
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					stream.CloseSend()
+				} else {
+					cancel()
+				}
+				return
+			}
+			note := &protos.RouteNote{}
+			if err := jsonpb.UnmarshalString(string(data), note); err != nil {
+				writeClose(conn, status.Errorf(codes.InvalidArgument, "frame is not a RouteNote: %v", err))
+				cancel()
+				return
+			}
+			if err := stream.Send(note); err != nil {
+				// the reason comes out of Recv below
+				return
+			}
+		}
+	}()
+
+	// server to browser, gorilla allows this single writer next to writeClose's control frames
+	marshaler := jsonpb.Marshaler{}
+	for {
+		note, err := stream.Recv()
+		if err == io.EOF {
+			writeClose(conn, nil)
+			return
+		}
+		if err != nil {
+			writeClose(conn, err)
+			return
+		}
+		data, err := marshaler.MarshalToString(note)
+		if err != nil {
+			writeClose(conn, status.Errorf(codes.Internal, "%v", err))
+			return
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(data)); err != nil {
+			return
+		}
+	}
+}
+
+// checkOrigin lets same origin pages and the allowed origins open a WebSocket
+func (g *Gateway) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not a browser
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return OriginAllowed(origin, g.AllowedOrigins)
+}
+
+// writeClose sends the close frame for err, nil being a normal end of the chat
+func writeClose(conn *websocket.Conn, err error) {
+	st := status.Convert(err)
+	reason := st.Message()
+	if len(reason) > maxCloseReason {
+		reason = reason[:maxCloseReason]
+		// don't leave half a character behind, browsers drop close frames that aren't valid UTF-8
+		for !utf8.ValidString(reason) {
+			reason = reason[:len(reason)-1]
+		}
+	}
+	msg := websocket.FormatCloseMessage(CloseCodeFromStatus(st.Code()), reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeWriteTimeout))
+}
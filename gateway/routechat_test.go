@@ -0,0 +1,222 @@
+package gateway
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/test/bufconn"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/auth"
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+	"gitlab.com/ethanlewis787/fun-with-grpc/server"
+)
+
+// testToken is the only bearer token the test server accepts
+const testToken = "s3cr3t"
+
+func TestRouteChatRoundTrip(t *testing.T) {
+	gw, _ := newTestGateway(t)
+	conn := dialRouteChat(t, gw, "?access_token="+testToken, nil)
+
+	first := &protos.RouteNote{Location: &protos.Point{Latitude: 1, Longitude: 2}, Message: "first"}
+	second := &protos.RouteNote{Location: &protos.Point{Latitude: 1, Longitude: 2}, Message: "second"}
+	sendNote(t, conn, first)
+	// every note is answered with the notes at its location the chat wasn't sent yet
+	expectNotes(t, conn, first)
+	sendNote(t, conn, second)
+	expectNotes(t, conn, second)
+
+	// a clean close from the browser finishes the chat, which the bridge confirms with 1000
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	code, _ := expectClose(t, conn)
+	if code != websocket.CloseNormalClosure {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseNormalClosure)
+	}
+}
+
+func TestRouteChatAuthorizationHeader(t *testing.T) {
+	gw, _ := newTestGateway(t)
+	conn := dialRouteChat(t, gw, "", http.Header{"Authorization": {"Bearer " + testToken}})
+	note := &protos.RouteNote{Location: &protos.Point{Latitude: 3, Longitude: 4}, Message: "header"}
+	sendNote(t, conn, note)
+	expectNotes(t, conn, note)
+}
+
+func TestRouteChatRejectsBadToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "wrong access_token", query: "?access_token=guess"},
+		{name: "empty access_token", query: "?access_token="},
+		{name: "no token", query: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw, rs := newTestGateway(t)
+			conn := dialRouteChat(t, gw, tt.query, nil)
+			// the call is only rejected once the first note reaches the server
+			sendNote(t, conn, &protos.RouteNote{Location: &protos.Point{Latitude: 5, Longitude: 6}, Message: "sneaky"})
+			code, _ := expectClose(t, conn)
+			if want := CloseCodeFromStatus(codes.Unauthenticated); code != want {
+				t.Errorf("close code = %d, want %d", code, want)
+			}
+			if n := rs.RouteNoteCount(); n != 0 {
+				t.Errorf("server stored %d notes from an unauthenticated chat", n)
+			}
+		})
+	}
+}
+
+func TestRouteChatCloseCodeFromStreamError(t *testing.T) {
+	gw, rs := newTestGateway(t)
+	conn := dialRouteChat(t, gw, "?access_token="+testToken, nil)
+	note := &protos.RouteNote{Location: &protos.Point{Latitude: 7, Longitude: 8}, Message: "before drain"}
+	sendNote(t, conn, note)
+	expectNotes(t, conn, note)
+
+	// draining ends the chat with Unavailable
+	rs.Drain()
+	code, reason := expectClose(t, conn)
+	if want := CloseCodeFromStatus(codes.Unavailable); code != want {
+		t.Errorf("close code = %d, want %d", code, want)
+	}
+	if reason != "server is shutting down" {
+		t.Errorf("close reason = %q, want the status message", reason)
+	}
+}
+
+func TestRouteChatRejectsMalformedFrame(t *testing.T) {
+	gw, _ := newTestGateway(t)
+	conn := dialRouteChat(t, gw, "?access_token="+testToken, nil)
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"message": 42}`))
+	code, _ := expectClose(t, conn)
+	if want := CloseCodeFromStatus(codes.InvalidArgument); code != want {
+		t.Errorf("close code = %d, want %d", code, want)
+	}
+}
+
+func TestRouteChatChecksOrigin(t *testing.T) {
+	gw, _ := newTestGateway(t)
+	url := "ws" + strings.TrimPrefix(gw.URL, "http") + "/routechat"
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}})
+	if err == nil {
+		t.Fatal("a page from another site opened a WebSocket")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("response = %v, want 403", resp)
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// tokenAuth accepts testToken as the principal "tester"
+type tokenAuth struct{}
+
+func (tokenAuth) Authenticate(token string) (*auth.Principal, error) {
+	if token != testToken {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Principal{Name: "tester"}, nil
+}
+
+// newTestGateway serves a Gateway over httptest, calling a RouteGuide server that requires
+// testToken over bufconn
+func newTestGateway(t *testing.T) (*httptest.Server, *server.RouteGuideServerImpl) {
+	rs := &server.RouteGuideServerImpl{RouteNotes: make(map[string][]*protos.RouteNote)}
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(auth.UnaryServerInterceptor(tokenAuth{}, nil)),
+		grpc.StreamInterceptor(auth.StreamServerInterceptor(tokenAuth{}, nil)),
+	)
+	protos.RegisterRouteGuideServer(grpcServer, rs)
+	lis := bufconn.Listen(1 << 20)
+	go grpcServer.Serve(lis)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := httptest.NewServer(New(protos.NewRouteGuideClient(conn)))
+	t.Cleanup(func() {
+		gw.Close()
+		conn.Close()
+		grpcServer.Stop()
+	})
+	return gw, rs
+}
+
+// dialRouteChat opens the RouteChat WebSocket, query is appended to the URL
+func dialRouteChat(t *testing.T, gw *httptest.Server, query string, header http.Header) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(gw.URL, "http") + "/routechat" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func sendNote(t *testing.T, conn *websocket.Conn, note *protos.RouteNote) {
+	data, err := (&jsonpb.Marshaler{}).MarshalToString(note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(data)); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+// expectNotes reads one text frame per note and compares them in order
+func expectNotes(t *testing.T, conn *websocket.Conn, want ...*protos.RouteNote) {
+	t.Helper()
+	for _, w := range want {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %q: %v", w.Message, err)
+		}
+		if kind != websocket.TextMessage {
+			t.Errorf("frame type = %d, want a text frame", kind)
+		}
+		got := &protos.RouteNote{}
+		if err := jsonpb.UnmarshalString(string(data), got); err != nil {
+			t.Fatalf("frame %s is not a RouteNote: %v", data, err)
+		}
+		if !proto.Equal(got, w) {
+			t.Errorf("received %v, want %v", got, w)
+		}
+	}
+}
+
+// expectClose reads until the close frame and returns its code and reason
+func expectClose(t *testing.T, conn *websocket.Conn) (int, string) {
+	t.Helper()
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		closeErr, ok := err.(*websocket.CloseError)
+		if !ok {
+			t.Fatalf("connection ended without a close frame: %v", err)
+		}
+		return closeErr.Code, closeErr.Text
+	}
+}
@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the request ID from the client to the server and back in the response headers
+const RequestIDHeader = "x-request-id"
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID the server interceptors placed on ctx
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// UnaryServerInterceptor logs every unary RPC once it completes
+func UnaryServerInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id := incomingRequestID(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+		start := time.Now()
+		resp, err := handler(context.WithValue(ctx, requestIDKey{}, id), req)
+		logger.Info("handled rpc",
+			zap.String("request_id", id),
+			zap.String("method", info.FullMethod),
+			zap.String("peer", peerAddr(ctx)),
+			zap.Duration("duration", time.Since(start)),
+			zap.Stringer("code", status.Code(err)),
+		)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs every streaming RPC once it completes, with the number of messages on it
+func StreamServerInterceptor(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		id := incomingRequestID(ss.Context())
+		ss.SetHeader(metadata.Pairs(RequestIDHeader, id))
+		stream := &loggingStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), requestIDKey{}, id)}
+		start := time.Now()
+		err := handler(srv, stream)
+		logger.Info("handled stream",
+			zap.String("request_id", id),
+			zap.String("method", info.FullMethod),
+			zap.String("peer", peerAddr(ss.Context())),
+			zap.Duration("duration", time.Since(start)),
+			zap.Stringer("code", status.Code(err)),
+			zap.Int64("msgs_sent", atomic.LoadInt64(&stream.sent)),
+			zap.Int64("msgs_received", atomic.LoadInt64(&stream.received)),
+		)
+		return err
+	}
+}
+
+// UnaryClientInterceptor sends a fresh request ID with every unary RPC and logs the call
+func UnaryClientInterceptor(logger *zap.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		id := newRequestID()
+		start := time.Now()
+		err := invoker(metadata.AppendToOutgoingContext(ctx, RequestIDHeader, id), method, req, reply, cc, opts...)
+		logger.Info("called rpc",
+			zap.String("request_id", id),
+			zap.String("method", method),
+			zap.Duration("duration", time.Since(start)),
+			zap.Stringer("code", status.Code(err)),
+		)
+		return err
+	}
+}
+
+// StreamClientInterceptor sends a fresh request ID with every streaming RPC.
+// The stream is logged when it is opened, its lifetime belongs to the caller.
+func StreamClientInterceptor(logger *zap.Logger) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		id := newRequestID()
+		cs, err := streamer(metadata.AppendToOutgoingContext(ctx, RequestIDHeader, id), desc, cc, method, opts...)
+		logger.Info("opened stream",
+			zap.String("request_id", id),
+			zap.String("method", method),
+			zap.Stringer("code", status.Code(err)),
+		)
+		return cs, err
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// incomingRequestID reuses the caller's request ID, or makes one up for callers that send none
+func incomingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDHeader); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return newRequestID()
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
+
+// loggingStream counts the messages on a ServerStream and carries the request ID on its context.
+// RouteChat sends and receives on different goroutines, so the counts are atomic.
+type loggingStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	sent     int64
+	received int64
+}
+
+func (s *loggingStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *loggingStream) SendMsg(msg interface{}) error {
+	err := s.ServerStream.SendMsg(msg)
+	if err == nil {
+		atomic.AddInt64(&s.sent, 1)
+	}
+	return err
+}
+
+func (s *loggingStream) RecvMsg(msg interface{}) error {
+	err := s.ServerStream.RecvMsg(msg)
+	if err == nil {
+		atomic.AddInt64(&s.received, 1)
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+// Package logging builds the zap loggers used by both binaries and logs every RPC
+// through interceptors, tagged with a request ID shared by the client and the server.
+package logging
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Options configures the logger built by New
+type Options struct {
+	// Level is the minimum level logged: debug, info, warn, error
+	Level string
+	// Format is "json" or "console"
+	Format string
+	// Sampling drops repeated messages under load, see zap.SamplingConfig
+	Sampling bool
+	// OutputPath is a file path, "stdout" or "stderr"
+	OutputPath string
+}
+
+// New builds a production zap logger from opts
+func New(opts Options) (*zap.Logger, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return nil, fmt.Errorf("logging: unknown level %q", opts.Level)
+	}
+	cfg := zap.NewProductionConfig()
+	switch opts.Format {
+	case "json":
+	case "console":
+		cfg.Encoding = "console"
+		cfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("logging: unknown format %q", opts.Format)
+	}
+	cfg.Level = zap.NewAtomicLevelAt(level)
+	if !opts.Sampling {
+		cfg.Sampling = nil
+	}
+	if opts.OutputPath != "" {
+		cfg.OutputPaths = []string{opts.OutputPath}
+	}
+	return cfg.Build()
+}
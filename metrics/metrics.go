@@ -0,0 +1,148 @@
+// Package metrics collects Prometheus metrics for the gRPC server through interceptors,
+// so every registered RPC is covered without touching its handler.
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics holds the server's collectors and the registry they are exposed from
+type Metrics struct {
+	// Registry is where every collector lives, other packages may register their own on it
+	Registry *prometheus.Registry
+
+	requests      *prometheus.CounterVec
+	latency       *prometheus.HistogramVec
+	streamMsgs    *prometheus.CounterVec
+	activeStreams *prometheus.GaugeVec
+	panics        *prometheus.CounterVec
+}
+
+// New creates the RPC collectors on a fresh registry, along with the Go runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "RPCs completed on the server, by method and status code.",
+		}, []string{"service", "method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Time taken to complete an RPC, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"service", "method"}),
+		streamMsgs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_stream_msgs_total",
+			Help: "Messages sent and received on streaming RPCs, by method and direction.",
+		}, []string{"service", "method", "direction"}),
+		activeStreams: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_server_active_streams",
+			Help: "Streaming RPCs currently open, by method.",
+		}, []string{"service", "method"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_panics_recovered_total",
+			Help: "Panics in RPC handlers recovered into an Internal status, by method.",
+		}, []string{"service", "method"}),
+	}
+	m.Registry.MustRegister(
+		m.requests, m.latency, m.streamMsgs, m.activeStreams, m.panics,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// AddGaugeFunc exposes a value computed at scrape time, e.g. the number of loaded features
+func (m *Metrics) AddGaugeFunc(name, help string, fn func() float64) {
+	m.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, fn))
+}
+
+// RecordPanic counts a panic recovered in the handler of fullMethod, pass it to the recovery interceptors
+func (m *Metrics) RecordPanic(fullMethod string) {
+	service, method := splitMethod(fullMethod)
+	m.panics.WithLabelValues(service, method).Inc()
+}
+
+// Handler serves the registry in the Prometheus text format, mount it on /metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// UnaryServerInterceptor counts unary RPCs and observes their latency
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		service, method := splitMethod(info.FullMethod)
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.observe(service, method, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor counts streaming RPCs, observes their latency and counts the messages on them
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		service, method := splitMethod(info.FullMethod)
+		active := m.activeStreams.WithLabelValues(service, method)
+		active.Inc()
+		defer active.Dec()
+
+		start := time.Now()
+		err := handler(srv, &countingStream{
+			ServerStream: ss,
+			sent:         m.streamMsgs.WithLabelValues(service, method, "sent"),
+			received:     m.streamMsgs.WithLabelValues(service, method, "received"),
+		})
+		m.observe(service, method, start, err)
+		return err
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+func (m *Metrics) observe(service, method string, start time.Time, err error) {
+	m.requests.WithLabelValues(service, method, status.Code(err).String()).Inc()
+	m.latency.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+}
+
+// splitMethod turns "/protos.RouteGuide/GetFeature" into "protos.RouteGuide" and "GetFeature"
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+// countingStream counts the messages going through a ServerStream
+type countingStream struct {
+	grpc.ServerStream
+	sent     prometheus.Counter
+	received prometheus.Counter
+}
+
+func (s *countingStream) SendMsg(msg interface{}) error {
+	err := s.ServerStream.SendMsg(msg)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+func (s *countingStream) RecvMsg(msg interface{}) error {
+	err := s.ServerStream.RecvMsg(msg)
+	if err == nil {
+		s.received.Inc()
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+// Package pagetoken encodes the ListFeatures page tokens. The server hands them out in its
+// next-page-token trailer, the client builds the same token to resume a listing that failed
+// part way through a page. A token holds the position of the last feature sent rather than an
+// offset, so it stays valid across feature reloads.
+package pagetoken
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// Trailer keys set by ListFeatures when a page does not hold every matching feature.
+const (
+	// NextPageTokenTrailer carries the page_token that resumes after the last feature sent.
+	NextPageTokenTrailer = "next-page-token"
+	// TruncatedTrailer is "true" when the server's per-call limit cut the page short.
+	TruncatedTrailer = "truncated"
+)
+
+// Position is the place of a feature in the stable ListFeatures order
+type Position struct {
+	Latitude  int32
+	Longitude int32
+	Name      string
+}
+
+// Of is the position of feature, a feature without a location sorts as 0,0
+func Of(feature *protos.Feature) Position {
+	return Position{
+		Latitude:  feature.GetLocation().GetLatitude(),
+		Longitude: feature.GetLocation().GetLongitude(),
+		Name:      feature.GetName(),
+	}
+}
+
+// Less orders positions by latitude, longitude then name
+func (p Position) Less(o Position) bool {
+	if p.Latitude != o.Latitude {
+		return p.Latitude < o.Latitude
+	}
+	if p.Longitude != o.Longitude {
+		return p.Longitude < o.Longitude
+	}
+	return p.Name < o.Name
+}
+
+// Encode turns the position of the last feature sent into an opaque page token
+func Encode(p Position) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d %d %s", p.Latitude, p.Longitude, p.Name)))
+}
+
+// Decode is the inverse of Encode
+func Decode(token string) (Position, error) {
+	var p Position
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return p, fmt.Errorf("malformed page token")
+	}
+	parts := strings.SplitN(string(raw), " ", 3)
+	if len(parts) != 3 {
+		return p, fmt.Errorf("malformed page token")
+	}
+	lat, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil {
+		return p, fmt.Errorf("malformed page token")
+	}
+	lng, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		return p, fmt.Errorf("malformed page token")
+	}
+	p.Latitude, p.Longitude, p.Name = int32(lat), int32(lng), parts[2]
+	return p, nil
+}
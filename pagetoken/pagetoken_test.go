@@ -0,0 +1,59 @@
+package pagetoken
+
+import (
+	"testing"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []Position{
+		{},
+		{Latitude: 407838351, Longitude: -746143763, Name: "Patriots Path, Mendham, NJ 07945, USA"},
+		{Latitude: -900000000, Longitude: 1800000000, Name: "name with  spaces "},
+	}
+	for _, p := range tests {
+		got, err := Decode(Encode(p))
+		if err != nil {
+			t.Errorf("Decode(Encode(%+v)): %v", p, err)
+			continue
+		}
+		if got != p {
+			t.Errorf("Decode(Encode(%+v)) = %+v", p, got)
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	for _, token := range []string{"not base64!", Encode(Position{})[:2], "MSAy", "eCAyIG5hbWU", "MSAzMDAwMDAwMDAwIG5hbWU"} {
+		if _, err := Decode(token); err == nil {
+			t.Errorf("Decode(%q) succeeded", token)
+		}
+	}
+}
+
+func TestOf(t *testing.T) {
+	feature := &protos.Feature{Name: "a", Location: &protos.Point{Latitude: 1, Longitude: 2}}
+	if got, want := Of(feature), (Position{Latitude: 1, Longitude: 2, Name: "a"}); got != want {
+		t.Errorf("Of = %+v, want %+v", got, want)
+	}
+	if got := Of(&protos.Feature{Name: "nowhere"}); got != (Position{Name: "nowhere"}) {
+		t.Errorf("Of without a location = %+v", got)
+	}
+}
+
+func TestLess(t *testing.T) {
+	ordered := []Position{
+		{Latitude: -1, Longitude: 5, Name: "z"},
+		{Latitude: 0, Longitude: -3, Name: "z"},
+		{Latitude: 0, Longitude: 0, Name: "a"},
+		{Latitude: 0, Longitude: 0, Name: "b"},
+	}
+	for i := range ordered {
+		for j := range ordered {
+			if got := ordered[i].Less(ordered[j]); got != (i < j) {
+				t.Errorf("%+v.Less(%+v) = %v", ordered[i], ordered[j], got)
+			}
+		}
+	}
+}
@@ -14,12 +14,20 @@ It has these top-level messages:
 	Feature
 	RouteNote
 	RouteSummary
+	SearchRequest
+	SearchResult
+	SearchResponse
+	ListFeaturesRequest
+	GetFeatureRequest
+	NearestFeaturesRequest
+	FeatureFilter
 */
 package protos
 
 import proto "github.com/golang/protobuf/proto"
 import fmt "fmt"
 import math "math"
+import google_protobuf "google.golang.org/genproto/protobuf/field_mask"
 
 import (
 	context "golang.org/x/net/context"
@@ -101,6 +109,12 @@ type Feature struct {
 	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
 	// the point where the feature is detected.
 	Location *Point `protobuf:"bytes,2,opt,name=location" json:"location,omitempty"`
+	// Free form labels, e.g. "trail" or "wheelchair-accessible".
+	Tags []string `protobuf:"bytes,3,rep,name=tags" json:"tags,omitempty"`
+	// The kind of feature, e.g. "park" or "restaurant".
+	Category string `protobuf:"bytes,4,opt,name=category" json:"category,omitempty"`
+	// Any other attributes, e.g. "opening_hours" -> "Mo-Fr 09:00-17:00".
+	Properties map[string]string `protobuf:"bytes,5,rep,name=properties" json:"properties,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 }
 
 func (m *Feature) Reset()                    { *m = Feature{} }
@@ -122,6 +136,27 @@ func (m *Feature) GetLocation() *Point {
 	return nil
 }
 
+func (m *Feature) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+func (m *Feature) GetCategory() string {
+	if m != nil {
+		return m.Category
+	}
+	return ""
+}
+
+func (m *Feature) GetProperties() map[string]string {
+	if m != nil {
+		return m.Properties
+	}
+	return nil
+}
+
 // A RouteNote is a message sent while at a given point.
 type RouteNote struct {
 	// The location from which the message is sent.
@@ -159,9 +194,12 @@ type RouteSummary struct {
 	// The number of known features passed while tranversing the route.
 	FeatureCount int32 `protobuf:"varint,2,opt,name=feature_count,json=featureCount" json:"feature_count,omitempty"`
 	// the distance covered in meters.
+	// Deprecated: saturates at 2^31-1, use distance_meters instead.
 	Distance int32 `protobuf:"varint,3,opt,name=distance" json:"distance,omitempty"`
 	// The duration of the traversal in seconds.
 	ElapsedTime int32 `protobuf:"varint,4,opt,name=elapsed_time,json=elapsedTime" json:"elapsed_time,omitempty"`
+	// The distance covered in meters, without the int32 overflow of distance.
+	DistanceMeters float64 `protobuf:"fixed64,5,opt,name=distance_meters,json=distanceMeters" json:"distance_meters,omitempty"`
 }
 
 func (m *RouteSummary) Reset()                    { *m = RouteSummary{} }
@@ -197,12 +235,299 @@ func (m *RouteSummary) GetElapsedTime() int32 {
 	return 0
 }
 
+func (m *RouteSummary) GetDistanceMeters() float64 {
+	if m != nil {
+		return m.DistanceMeters
+	}
+	return 0
+}
+
+// A SearchRequest is sent to the SearchFeatures rpc.
+type SearchRequest struct {
+	// Free text to look for in feature names, e.g. "mendham nj".
+	Query string `protobuf:"bytes,1,opt,name=query" json:"query,omitempty"`
+	// The maximum number of results to return. The server picks a default when zero.
+	MaxResults int32 `protobuf:"varint,2,opt,name=max_results,json=maxResults" json:"max_results,omitempty"`
+	// Only return features inside this rectangle when set.
+	Bounds *Rectangle `protobuf:"bytes,3,opt,name=bounds" json:"bounds,omitempty"`
+}
+
+func (m *SearchRequest) Reset()                    { *m = SearchRequest{} }
+func (m *SearchRequest) String() string            { return proto.CompactTextString(m) }
+func (*SearchRequest) ProtoMessage()               {}
+func (*SearchRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *SearchRequest) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+func (m *SearchRequest) GetMaxResults() int32 {
+	if m != nil {
+		return m.MaxResults
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetBounds() *Rectangle {
+	if m != nil {
+		return m.Bounds
+	}
+	return nil
+}
+
+// A SearchResult is a feature matched by a search, along with its relevance score.
+type SearchResult struct {
+	// The matched feature.
+	Feature *Feature `protobuf:"bytes,1,opt,name=feature" json:"feature,omitempty"`
+	// The relevance of the match, higher is better.
+	Score float64 `protobuf:"fixed64,2,opt,name=score" json:"score,omitempty"`
+}
+
+func (m *SearchResult) Reset()                    { *m = SearchResult{} }
+func (m *SearchResult) String() string            { return proto.CompactTextString(m) }
+func (*SearchResult) ProtoMessage()               {}
+func (*SearchResult) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *SearchResult) GetFeature() *Feature {
+	if m != nil {
+		return m.Feature
+	}
+	return nil
+}
+
+func (m *SearchResult) GetScore() float64 {
+	if m != nil {
+		return m.Score
+	}
+	return 0
+}
+
+// A SearchResponse holds the ranked results of a SearchFeatures rpc.
+type SearchResponse struct {
+	// The results ordered by descending score.
+	Results []*SearchResult `protobuf:"bytes,1,rep,name=results" json:"results,omitempty"`
+}
+
+func (m *SearchResponse) Reset()                    { *m = SearchResponse{} }
+func (m *SearchResponse) String() string            { return proto.CompactTextString(m) }
+func (*SearchResponse) ProtoMessage()               {}
+func (*SearchResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *SearchResponse) GetResults() []*SearchResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+// A ListFeaturesRequest is sent to the ListFeatures rpc.
+//
+// lo and hi use the same field numbers as Rectangle, so a plain Rectangle is still a valid request.
+type ListFeaturesRequest struct {
+	// Once corner of the rectangle
+	Lo *Point `protobuf:"bytes,1,opt,name=lo" json:"lo,omitempty"`
+	// The other corner of the rectangle.
+	Hi *Point `protobuf:"bytes,2,opt,name=hi" json:"hi,omitempty"`
+	// The maximum number of features to return, zero means as many as the server allows.
+	MaxResults int32 `protobuf:"varint,3,opt,name=max_results,json=maxResults" json:"max_results,omitempty"`
+	// The next-page-token trailer of a previous call, used to resume after its last feature.
+	PageToken string `protobuf:"bytes,4,opt,name=page_token,json=pageToken" json:"page_token,omitempty"`
+	// The Feature fields to return, e.g. "name". All fields are returned when empty.
+	ReadMask *google_protobuf.FieldMask `protobuf:"bytes,5,opt,name=read_mask,json=readMask" json:"read_mask,omitempty"`
+	// Only return features matching this filter when set.
+	Filter *FeatureFilter `protobuf:"bytes,6,opt,name=filter" json:"filter,omitempty"`
+}
+
+func (m *ListFeaturesRequest) Reset()                    { *m = ListFeaturesRequest{} }
+func (m *ListFeaturesRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListFeaturesRequest) ProtoMessage()               {}
+func (*ListFeaturesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *ListFeaturesRequest) GetLo() *Point {
+	if m != nil {
+		return m.Lo
+	}
+	return nil
+}
+
+func (m *ListFeaturesRequest) GetHi() *Point {
+	if m != nil {
+		return m.Hi
+	}
+	return nil
+}
+
+func (m *ListFeaturesRequest) GetMaxResults() int32 {
+	if m != nil {
+		return m.MaxResults
+	}
+	return 0
+}
+
+func (m *ListFeaturesRequest) GetPageToken() string {
+	if m != nil {
+		return m.PageToken
+	}
+	return ""
+}
+
+func (m *ListFeaturesRequest) GetReadMask() *google_protobuf.FieldMask {
+	if m != nil {
+		return m.ReadMask
+	}
+	return nil
+}
+
+func (m *ListFeaturesRequest) GetFilter() *FeatureFilter {
+	if m != nil {
+		return m.Filter
+	}
+	return nil
+}
+
+// A GetFeatureRequest is sent to the GetFeature rpc.
+//
+// latitude and longitude use the same field numbers as Point, so a plain Point is still a valid request.
+type GetFeatureRequest struct {
+	Latitude  int32 `protobuf:"varint,1,opt,name=latitude" json:"latitude,omitempty"`
+	Longitude int32 `protobuf:"varint,2,opt,name=longitude" json:"longitude,omitempty"`
+	// The Feature fields to return, e.g. "name". All fields are returned when empty.
+	ReadMask *google_protobuf.FieldMask `protobuf:"bytes,3,opt,name=read_mask,json=readMask" json:"read_mask,omitempty"`
+}
+
+func (m *GetFeatureRequest) Reset()                    { *m = GetFeatureRequest{} }
+func (m *GetFeatureRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetFeatureRequest) ProtoMessage()               {}
+func (*GetFeatureRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *GetFeatureRequest) GetLatitude() int32 {
+	if m != nil {
+		return m.Latitude
+	}
+	return 0
+}
+
+func (m *GetFeatureRequest) GetLongitude() int32 {
+	if m != nil {
+		return m.Longitude
+	}
+	return 0
+}
+
+func (m *GetFeatureRequest) GetReadMask() *google_protobuf.FieldMask {
+	if m != nil {
+		return m.ReadMask
+	}
+	return nil
+}
+
+// A NearestFeaturesRequest is sent to the NearestFeatures rpc.
+type NearestFeaturesRequest struct {
+	// The point to measure from.
+	Location *Point `protobuf:"bytes,1,opt,name=location" json:"location,omitempty"`
+	// The maximum number of features to return. The server picks a default when zero.
+	MaxResults int32 `protobuf:"varint,2,opt,name=max_results,json=maxResults" json:"max_results,omitempty"`
+	// Only return features within this many meters of location when non zero.
+	MaxDistanceMeters float64 `protobuf:"fixed64,3,opt,name=max_distance_meters,json=maxDistanceMeters" json:"max_distance_meters,omitempty"`
+	// The Feature fields to return, e.g. "name". All fields are returned when empty.
+	ReadMask *google_protobuf.FieldMask `protobuf:"bytes,4,opt,name=read_mask,json=readMask" json:"read_mask,omitempty"`
+	// Only return features matching this filter when set.
+	Filter *FeatureFilter `protobuf:"bytes,5,opt,name=filter" json:"filter,omitempty"`
+}
+
+func (m *NearestFeaturesRequest) Reset()                    { *m = NearestFeaturesRequest{} }
+func (m *NearestFeaturesRequest) String() string            { return proto.CompactTextString(m) }
+func (*NearestFeaturesRequest) ProtoMessage()               {}
+func (*NearestFeaturesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *NearestFeaturesRequest) GetLocation() *Point {
+	if m != nil {
+		return m.Location
+	}
+	return nil
+}
+
+func (m *NearestFeaturesRequest) GetMaxResults() int32 {
+	if m != nil {
+		return m.MaxResults
+	}
+	return 0
+}
+
+func (m *NearestFeaturesRequest) GetMaxDistanceMeters() float64 {
+	if m != nil {
+		return m.MaxDistanceMeters
+	}
+	return 0
+}
+
+func (m *NearestFeaturesRequest) GetReadMask() *google_protobuf.FieldMask {
+	if m != nil {
+		return m.ReadMask
+	}
+	return nil
+}
+
+func (m *NearestFeaturesRequest) GetFilter() *FeatureFilter {
+	if m != nil {
+		return m.Filter
+	}
+	return nil
+}
+
+// A FeatureFilter narrows a query down to features with the given attributes.
+// Every field that is set must match.
+type FeatureFilter struct {
+	// The feature must carry all of these tags.
+	Tags []string `protobuf:"bytes,1,rep,name=tags" json:"tags,omitempty"`
+	// The feature must be in this category.
+	Category string `protobuf:"bytes,2,opt,name=category" json:"category,omitempty"`
+	// The feature must have each of these properties with the same value.
+	Properties map[string]string `protobuf:"bytes,3,rep,name=properties" json:"properties,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *FeatureFilter) Reset()                    { *m = FeatureFilter{} }
+func (m *FeatureFilter) String() string            { return proto.CompactTextString(m) }
+func (*FeatureFilter) ProtoMessage()               {}
+func (*FeatureFilter) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *FeatureFilter) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+func (m *FeatureFilter) GetCategory() string {
+	if m != nil {
+		return m.Category
+	}
+	return ""
+}
+
+func (m *FeatureFilter) GetProperties() map[string]string {
+	if m != nil {
+		return m.Properties
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Point)(nil), "protos.Point")
 	proto.RegisterType((*Rectangle)(nil), "protos.Rectangle")
 	proto.RegisterType((*Feature)(nil), "protos.Feature")
 	proto.RegisterType((*RouteNote)(nil), "protos.RouteNote")
 	proto.RegisterType((*RouteSummary)(nil), "protos.RouteSummary")
+	proto.RegisterType((*SearchRequest)(nil), "protos.SearchRequest")
+	proto.RegisterType((*SearchResult)(nil), "protos.SearchResult")
+	proto.RegisterType((*SearchResponse)(nil), "protos.SearchResponse")
+	proto.RegisterType((*ListFeaturesRequest)(nil), "protos.ListFeaturesRequest")
+	proto.RegisterType((*GetFeatureRequest)(nil), "protos.GetFeatureRequest")
+	proto.RegisterType((*NearestFeaturesRequest)(nil), "protos.NearestFeaturesRequest")
+	proto.RegisterType((*FeatureFilter)(nil), "protos.FeatureFilter")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -220,12 +545,14 @@ type RouteGuideClient interface {
 	//
 	// obtains the feature at a given position
 	// A Feature with an empty name is returned if there's no feature at the given position.
-	GetFeature(ctx context.Context, in *Point, opts ...grpc.CallOption) (*Feature, error)
+	GetFeature(ctx context.Context, in *GetFeatureRequest, opts ...grpc.CallOption) (*Feature, error)
 	// A Server-to-client streaming RPC
 	//
 	// Obtains the Features available within the given Rectangle. Results are streamed rather than returend at once
 	// (e.g in a response message with a repeated field), as the rectangle may cover a large area and contain a huge number of features.
-	ListFeatures(ctx context.Context, in *Rectangle, opts ...grpc.CallOption) (RouteGuide_ListFeaturesClient, error)
+	// Features are ordered by latitude, longitude then name. When more features remain the stream ends with a
+	// "next-page-token" trailer, and a "truncated" trailer is set when the server's per-call limit cut the page short.
+	ListFeatures(ctx context.Context, in *ListFeaturesRequest, opts ...grpc.CallOption) (RouteGuide_ListFeaturesClient, error)
 	// A client-to-server streaming RPC
 	//
 	// Accepts a stream of Points on a route being traversed, returning a RouteSummary when traversal is completed.
@@ -234,6 +561,15 @@ type RouteGuideClient interface {
 	//
 	// Accepts a stream  of RouteNotes sent while a route is being traversed, while receiving other routeNotes (e.g. from other users )
 	RouteChat(ctx context.Context, opts ...grpc.CallOption) (RouteGuide_RouteChatClient, error)
+	// A simple RPC
+	//
+	// Searches feature names for the words in the query. Words match exactly, as a prefix or
+	// within a small edit distance, and the results are ranked best match first.
+	SearchFeatures(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// A Server-to-client streaming RPC
+	//
+	// Obtains the Features closest to the given Point, nearest first.
+	NearestFeatures(ctx context.Context, in *NearestFeaturesRequest, opts ...grpc.CallOption) (RouteGuide_NearestFeaturesClient, error)
 }
 
 type routeGuideClient struct {
@@ -244,7 +580,7 @@ func NewRouteGuideClient(cc *grpc.ClientConn) RouteGuideClient {
 	return &routeGuideClient{cc}
 }
 
-func (c *routeGuideClient) GetFeature(ctx context.Context, in *Point, opts ...grpc.CallOption) (*Feature, error) {
+func (c *routeGuideClient) GetFeature(ctx context.Context, in *GetFeatureRequest, opts ...grpc.CallOption) (*Feature, error) {
 	out := new(Feature)
 	err := grpc.Invoke(ctx, "/protos.RouteGuide/GetFeature", in, out, c.cc, opts...)
 	if err != nil {
@@ -253,7 +589,7 @@ func (c *routeGuideClient) GetFeature(ctx context.Context, in *Point, opts ...gr
 	return out, nil
 }
 
-func (c *routeGuideClient) ListFeatures(ctx context.Context, in *Rectangle, opts ...grpc.CallOption) (RouteGuide_ListFeaturesClient, error) {
+func (c *routeGuideClient) ListFeatures(ctx context.Context, in *ListFeaturesRequest, opts ...grpc.CallOption) (RouteGuide_ListFeaturesClient, error) {
 	stream, err := grpc.NewClientStream(ctx, &_RouteGuide_serviceDesc.Streams[0], c.cc, "/protos.RouteGuide/ListFeatures", opts...)
 	if err != nil {
 		return nil, err
@@ -350,6 +686,47 @@ func (x *routeGuideRouteChatClient) Recv() (*RouteNote, error) {
 	return m, nil
 }
 
+func (c *routeGuideClient) SearchFeatures(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	out := new(SearchResponse)
+	err := grpc.Invoke(ctx, "/protos.RouteGuide/SearchFeatures", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *routeGuideClient) NearestFeatures(ctx context.Context, in *NearestFeaturesRequest, opts ...grpc.CallOption) (RouteGuide_NearestFeaturesClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_RouteGuide_serviceDesc.Streams[3], c.cc, "/protos.RouteGuide/NearestFeatures", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &routeGuideNearestFeaturesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type RouteGuide_NearestFeaturesClient interface {
+	Recv() (*Feature, error)
+	grpc.ClientStream
+}
+
+type routeGuideNearestFeaturesClient struct {
+	grpc.ClientStream
+}
+
+func (x *routeGuideNearestFeaturesClient) Recv() (*Feature, error) {
+	m := new(Feature)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for RouteGuide service
 
 type RouteGuideServer interface {
@@ -357,12 +734,14 @@ type RouteGuideServer interface {
 	//
 	// obtains the feature at a given position
 	// A Feature with an empty name is returned if there's no feature at the given position.
-	GetFeature(context.Context, *Point) (*Feature, error)
+	GetFeature(context.Context, *GetFeatureRequest) (*Feature, error)
 	// A Server-to-client streaming RPC
 	//
 	// Obtains the Features available within the given Rectangle. Results are streamed rather than returend at once
 	// (e.g in a response message with a repeated field), as the rectangle may cover a large area and contain a huge number of features.
-	ListFeatures(*Rectangle, RouteGuide_ListFeaturesServer) error
+	// Features are ordered by latitude, longitude then name. When more features remain the stream ends with a
+	// "next-page-token" trailer, and a "truncated" trailer is set when the server's per-call limit cut the page short.
+	ListFeatures(*ListFeaturesRequest, RouteGuide_ListFeaturesServer) error
 	// A client-to-server streaming RPC
 	//
 	// Accepts a stream of Points on a route being traversed, returning a RouteSummary when traversal is completed.
@@ -371,6 +750,15 @@ type RouteGuideServer interface {
 	//
 	// Accepts a stream  of RouteNotes sent while a route is being traversed, while receiving other routeNotes (e.g. from other users )
 	RouteChat(RouteGuide_RouteChatServer) error
+	// A simple RPC
+	//
+	// Searches feature names for the words in the query. Words match exactly, as a prefix or
+	// within a small edit distance, and the results are ranked best match first.
+	SearchFeatures(context.Context, *SearchRequest) (*SearchResponse, error)
+	// A Server-to-client streaming RPC
+	//
+	// Obtains the Features closest to the given Point, nearest first.
+	NearestFeatures(*NearestFeaturesRequest, RouteGuide_NearestFeaturesServer) error
 }
 
 func RegisterRouteGuideServer(s *grpc.Server, srv RouteGuideServer) {
@@ -378,7 +766,7 @@ func RegisterRouteGuideServer(s *grpc.Server, srv RouteGuideServer) {
 }
 
 func _RouteGuide_GetFeature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Point)
+	in := new(GetFeatureRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -390,13 +778,13 @@ func _RouteGuide_GetFeature_Handler(srv interface{}, ctx context.Context, dec fu
 		FullMethod: "/protos.RouteGuide/GetFeature",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(RouteGuideServer).GetFeature(ctx, req.(*Point))
+		return srv.(RouteGuideServer).GetFeature(ctx, req.(*GetFeatureRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
 func _RouteGuide_ListFeatures_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(Rectangle)
+	m := new(ListFeaturesRequest)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
@@ -468,6 +856,45 @@ func (x *routeGuideRouteChatServer) Recv() (*RouteNote, error) {
 	return m, nil
 }
 
+func _RouteGuide_SearchFeatures_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RouteGuideServer).SearchFeatures(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protos.RouteGuide/SearchFeatures",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RouteGuideServer).SearchFeatures(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RouteGuide_NearestFeatures_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(NearestFeaturesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RouteGuideServer).NearestFeatures(m, &routeGuideNearestFeaturesServer{stream})
+}
+
+type RouteGuide_NearestFeaturesServer interface {
+	Send(*Feature) error
+	grpc.ServerStream
+}
+
+type routeGuideNearestFeaturesServer struct {
+	grpc.ServerStream
+}
+
+func (x *routeGuideNearestFeaturesServer) Send(m *Feature) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _RouteGuide_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protos.RouteGuide",
 	HandlerType: (*RouteGuideServer)(nil),
@@ -476,6 +903,10 @@ var _RouteGuide_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetFeature",
 			Handler:    _RouteGuide_GetFeature_Handler,
 		},
+		{
+			MethodName: "SearchFeatures",
+			Handler:    _RouteGuide_SearchFeatures_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -494,6 +925,11 @@ var _RouteGuide_serviceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "NearestFeatures",
+			Handler:       _RouteGuide_NearestFeatures_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "route_guide.proto",
 }
@@ -501,29 +937,58 @@ var _RouteGuide_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("route_guide.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 372 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x7c, 0x52, 0xc1, 0x4e, 0xc2, 0x40,
-	0x10, 0x65, 0x11, 0x84, 0x4e, 0x4b, 0x0c, 0x13, 0x0f, 0x4d, 0xa3, 0x51, 0xeb, 0x05, 0x2f, 0x84,
-	0x60, 0x82, 0x67, 0x43, 0x22, 0x9a, 0x18, 0x43, 0xaa, 0x77, 0xb2, 0xb6, 0x6b, 0xd9, 0xa4, 0xed,
-	0x92, 0xee, 0xf6, 0xe0, 0x77, 0xf8, 0x8d, 0xfe, 0x87, 0xe9, 0x6e, 0x5b, 0x41, 0x88, 0x27, 0x98,
-	0xf7, 0xe6, 0xcd, 0xdb, 0x79, 0x53, 0x18, 0xe6, 0xa2, 0x50, 0x6c, 0x15, 0x17, 0x3c, 0x62, 0xe3,
-	0x4d, 0x2e, 0x94, 0xc0, 0x63, 0xfd, 0x23, 0xfd, 0x7b, 0xe8, 0x2e, 0x05, 0xcf, 0x14, 0x7a, 0xd0,
-	0x4f, 0xa8, 0xe2, 0xaa, 0x88, 0x98, 0x4b, 0x2e, 0xc9, 0xa8, 0x1b, 0x34, 0x35, 0x9e, 0x81, 0x95,
-	0x88, 0x2c, 0x36, 0x64, 0x5b, 0x93, 0xbf, 0x80, 0xff, 0x04, 0x56, 0xc0, 0x42, 0x45, 0xb3, 0x38,
-	0x61, 0x78, 0x0e, 0xed, 0x44, 0xe8, 0x01, 0xf6, 0x74, 0x60, 0xbc, 0xe4, 0x58, 0x3b, 0x04, 0xed,
-	0x44, 0x94, 0xf4, 0x9a, 0xeb, 0x11, 0xfb, 0xf4, 0x9a, 0xfb, 0x8f, 0xd0, 0x7b, 0x60, 0x54, 0x15,
-	0x39, 0x43, 0x84, 0x4e, 0x46, 0x53, 0xf3, 0x16, 0x2b, 0xd0, 0xff, 0xf1, 0x06, 0xfa, 0x89, 0x08,
-	0xa9, 0xe2, 0x22, 0x3b, 0x3c, 0xa3, 0xa1, 0xfd, 0x25, 0x58, 0x41, 0xb9, 0xf4, 0x8b, 0x50, 0xbb,
-	0x3a, 0xf2, 0xaf, 0x0e, 0x5d, 0xe8, 0xa5, 0x4c, 0x4a, 0x1a, 0x9b, 0x45, 0xad, 0xa0, 0x2e, 0xfd,
-	0x2f, 0x02, 0x8e, 0x1e, 0xf9, 0x5a, 0xa4, 0x29, 0xcd, 0x3f, 0xf1, 0x02, 0xec, 0x4d, 0xa9, 0x5e,
-	0x85, 0xa2, 0xc8, 0x54, 0x15, 0x1a, 0x68, 0x68, 0x5e, 0x22, 0x78, 0x0d, 0x83, 0x0f, 0xb3, 0x4d,
-	0xd5, 0x62, 0xa2, 0x73, 0x2a, 0xd0, 0x34, 0x79, 0xd0, 0x8f, 0xb8, 0x54, 0x34, 0x0b, 0x99, 0x7b,
-	0x64, 0x72, 0xaf, 0x6b, 0xbc, 0x02, 0x87, 0x25, 0x74, 0x23, 0x59, 0xb4, 0x52, 0x3c, 0x65, 0x6e,
-	0x47, 0xf3, 0x76, 0x85, 0xbd, 0xf1, 0x94, 0x4d, 0xbf, 0x09, 0x80, 0x7e, 0xd5, 0xa2, 0x3c, 0x2e,
-	0x8e, 0x01, 0x16, 0x4c, 0xd5, 0x19, 0xee, 0x6e, 0xe9, 0x9d, 0xd4, 0x65, 0xc5, 0xfb, 0x2d, 0x9c,
-	0x81, 0xf3, 0xcc, 0x65, 0x2d, 0x90, 0x38, 0xac, 0x5b, 0x9a, 0x8b, 0x1e, 0x50, 0x4d, 0x08, 0xce,
-	0xc0, 0x0e, 0x58, 0x28, 0xf2, 0x48, 0x7b, 0xff, 0x35, 0x3a, 0x6d, 0xa6, 0x6c, 0xe5, 0xe5, 0xb7,
-	0x46, 0x04, 0xef, 0xaa, 0xb3, 0xcc, 0xd7, 0x54, 0x6d, 0x99, 0xd5, 0x97, 0xf2, 0xf6, 0xa1, 0x52,
-	0x36, 0x21, 0xef, 0xe6, 0x7b, 0xbd, 0xfd, 0x09, 0x00, 0x00, 0xff, 0xff, 0x48, 0x4b, 0x04, 0x40,
-	0xcb, 0x02, 0x00, 0x00,
+	// 834 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x56, 0xdb, 0x6e, 0xdc, 0x44,
+	0x18, 0xce, 0xac, 0xb3, 0x49, 0xf6, 0xdf, 0x4d, 0xc3, 0x4e, 0x0f, 0x32, 0x86, 0xd2, 0x60, 0x84,
+	0x48, 0x2e, 0x70, 0xab, 0x45, 0x02, 0x54, 0x09, 0xd1, 0xaa, 0x34, 0x15, 0x12, 0x2d, 0xd1, 0xb4,
+	0xf7, 0xab, 0x89, 0xf7, 0x8f, 0x63, 0xc5, 0xf6, 0x6c, 0x66, 0xc6, 0x28, 0x79, 0x81, 0x3e, 0x15,
+	0xb7, 0xbc, 0x13, 0x12, 0x5c, 0xa0, 0x99, 0xf1, 0xb8, 0xb1, 0x77, 0x81, 0x52, 0xd4, 0xab, 0x9d,
+	0xff, 0x7c, 0xfe, 0xbc, 0x30, 0x95, 0xa2, 0xd6, 0x38, 0xcf, 0xea, 0x7c, 0x81, 0xc9, 0x52, 0x0a,
+	0x2d, 0xe8, 0x96, 0xfd, 0x51, 0xd1, 0x7e, 0x26, 0x44, 0x56, 0xe0, 0x7d, 0x4b, 0x9e, 0xd4, 0xa7,
+	0xf7, 0x4f, 0x73, 0x2c, 0x16, 0xf3, 0x92, 0xab, 0x73, 0xa7, 0x19, 0x3f, 0x86, 0xe1, 0xb1, 0xc8,
+	0x2b, 0x4d, 0x23, 0xd8, 0x29, 0xb8, 0xce, 0x75, 0xbd, 0xc0, 0x90, 0xec, 0x93, 0x83, 0x21, 0x6b,
+	0x69, 0xfa, 0x31, 0x8c, 0x0a, 0x51, 0x65, 0x4e, 0x38, 0xb0, 0xc2, 0x37, 0x8c, 0xf8, 0x47, 0x18,
+	0x31, 0x4c, 0x35, 0xaf, 0xb2, 0x02, 0xe9, 0x5d, 0x18, 0x14, 0xc2, 0x3a, 0x18, 0xcf, 0x76, 0x5d,
+	0x0c, 0x95, 0xd8, 0x08, 0x6c, 0x50, 0x08, 0x23, 0x3e, 0xcb, 0xc3, 0xc1, 0x5a, 0xf1, 0x59, 0x1e,
+	0xff, 0x4e, 0x60, 0xfb, 0x08, 0xb9, 0xae, 0x25, 0x52, 0x0a, 0x9b, 0x15, 0x2f, 0x5d, 0x32, 0x23,
+	0x66, 0xdf, 0xf4, 0x10, 0x76, 0x0a, 0x91, 0x72, 0x9d, 0x8b, 0x6a, 0xbd, 0x93, 0x56, 0x6c, 0xcc,
+	0x35, 0xcf, 0x54, 0x18, 0xec, 0x07, 0xc6, 0xdc, 0xbc, 0x4d, 0x8d, 0x29, 0xd7, 0x98, 0x09, 0x79,
+	0x15, 0x6e, 0x5a, 0xb7, 0x2d, 0x4d, 0xbf, 0x07, 0x58, 0x4a, 0xb1, 0x44, 0xa9, 0x73, 0x54, 0xe1,
+	0x70, 0x3f, 0x38, 0x18, 0xcf, 0xee, 0x79, 0xe7, 0x4d, 0x4e, 0xc9, 0x71, 0xab, 0xf1, 0xb4, 0xd2,
+	0xf2, 0x8a, 0x5d, 0x33, 0x89, 0xbe, 0x83, 0xbd, 0x9e, 0x98, 0x7e, 0x00, 0xc1, 0x39, 0x5e, 0x35,
+	0x15, 0x98, 0x27, 0xbd, 0x05, 0xc3, 0x5f, 0x78, 0x51, 0xbb, 0x2e, 0x8e, 0x98, 0x23, 0x1e, 0x0e,
+	0xbe, 0x25, 0xf1, 0x31, 0x8c, 0x98, 0x99, 0xe3, 0x0b, 0xa1, 0xbb, 0x75, 0x92, 0x7f, 0xae, 0x33,
+	0x84, 0xed, 0x12, 0x95, 0xe2, 0x99, 0xf7, 0xe9, 0xc9, 0xf8, 0x57, 0x02, 0x13, 0xeb, 0xf2, 0x65,
+	0x5d, 0x96, 0x5c, 0x5e, 0xd1, 0x7b, 0x30, 0x5e, 0x1a, 0xeb, 0x79, 0x2a, 0xea, 0x4a, 0x37, 0x53,
+	0x06, 0xcb, 0x7a, 0x62, 0x38, 0xf4, 0x33, 0xd8, 0x3d, 0x75, 0x95, 0x36, 0x2a, 0x6e, 0xd6, 0x93,
+	0x86, 0xe9, 0x94, 0x22, 0xd8, 0x59, 0xe4, 0x4a, 0xf3, 0x2a, 0xc5, 0x30, 0x70, 0x8b, 0xe2, 0x69,
+	0xfa, 0x29, 0x4c, 0xb0, 0xe0, 0x4b, 0x85, 0x8b, 0xb9, 0xce, 0x4b, 0xb4, 0x4d, 0x1e, 0xb2, 0x71,
+	0xc3, 0x7b, 0x95, 0x97, 0x48, 0xbf, 0x80, 0x3d, 0xaf, 0x3e, 0x2f, 0x51, 0xa3, 0x34, 0xcd, 0x26,
+	0x07, 0x84, 0xdd, 0xf0, 0xec, 0xe7, 0x96, 0x1b, 0x5f, 0xc0, 0xee, 0x4b, 0xe4, 0x32, 0x3d, 0x63,
+	0x78, 0x51, 0xa3, 0xd2, 0xa6, 0x77, 0x17, 0x35, 0x4a, 0xdf, 0x4f, 0x47, 0x98, 0xa2, 0x4a, 0x7e,
+	0x39, 0x97, 0xa8, 0xea, 0x42, 0xab, 0x26, 0x63, 0x28, 0xf9, 0x25, 0x73, 0x1c, 0x7a, 0x08, 0x5b,
+	0x27, 0xa2, 0xae, 0x16, 0xca, 0x66, 0x3b, 0x9e, 0x4d, 0x7d, 0x27, 0xdb, 0xa5, 0x65, 0x8d, 0x42,
+	0xfc, 0x33, 0x4c, 0x7c, 0x48, 0x63, 0x4b, 0x0f, 0x61, 0xbb, 0x29, 0xbd, 0x99, 0xc2, 0x5e, 0x6f,
+	0x21, 0x98, 0x97, 0x9b, 0xe4, 0x54, 0x2a, 0xa4, 0x1b, 0x02, 0x61, 0x8e, 0x88, 0x1f, 0xc1, 0x8d,
+	0xd6, 0xe1, 0x52, 0x54, 0x0a, 0x69, 0x02, 0xdb, 0x3e, 0x55, 0x62, 0x77, 0xec, 0x96, 0x77, 0x79,
+	0x3d, 0x32, 0xf3, 0x4a, 0xf1, 0x1f, 0x04, 0x6e, 0xfe, 0x94, 0x2b, 0xdd, 0x04, 0x54, 0xbe, 0x19,
+	0xff, 0xeb, 0xce, 0xfa, 0x4d, 0x0b, 0x56, 0x9a, 0x76, 0x17, 0x60, 0xc9, 0x33, 0x9c, 0x6b, 0x71,
+	0x8e, 0x55, 0x73, 0x2b, 0x23, 0xc3, 0x79, 0x65, 0x18, 0xf4, 0x1b, 0x18, 0x49, 0xe4, 0x0e, 0x48,
+	0xec, 0xf8, 0xc6, 0xb3, 0x28, 0x71, 0x58, 0x93, 0x78, 0xac, 0x49, 0x8e, 0x0c, 0xd6, 0x3c, 0xe7,
+	0xea, 0x9c, 0xed, 0x18, 0x65, 0xf3, 0xa2, 0x5f, 0xc2, 0xd6, 0x69, 0x5e, 0x68, 0x94, 0xe1, 0x96,
+	0xb5, 0xba, 0xdd, 0x6b, 0xe8, 0x91, 0x15, 0xb2, 0x46, 0x29, 0x7e, 0x4d, 0x60, 0xfa, 0x0c, 0x7d,
+	0xf1, 0xbe, 0xf6, 0x77, 0x86, 0xaa, 0x6e, 0xde, 0xc1, 0xdb, 0xe7, 0x1d, 0xff, 0x49, 0xe0, 0xce,
+	0x0b, 0xe4, 0x12, 0x57, 0x27, 0xf1, 0x1f, 0x6e, 0xf5, 0x5f, 0x77, 0x35, 0x81, 0x9b, 0x46, 0xa1,
+	0x7f, 0x20, 0x81, 0xdd, 0xa9, 0x69, 0xc9, 0x2f, 0x7f, 0xe8, 0xdc, 0x48, 0xb7, 0x9e, 0xcd, 0x77,
+	0x9a, 0xc3, 0xf0, 0x6d, 0xe6, 0xf0, 0x1b, 0x81, 0xdd, 0x8e, 0xa4, 0x85, 0x57, 0xf2, 0x37, 0xf0,
+	0x3a, 0xe8, 0xc1, 0xeb, 0xd3, 0x0e, 0xbc, 0x06, 0x76, 0xf5, 0x3f, 0x5f, 0x1b, 0xf4, 0x3d, 0x82,
+	0xec, 0xec, 0x75, 0x00, 0x60, 0x21, 0xf1, 0x99, 0xf9, 0x58, 0xd2, 0x87, 0x00, 0x6f, 0xb6, 0x8b,
+	0x7e, 0xe8, 0xd3, 0x59, 0xd9, 0xb8, 0xa8, 0x7f, 0xf7, 0xf1, 0x06, 0x7d, 0x04, 0x93, 0xeb, 0x77,
+	0x49, 0x3f, 0xf2, 0x2a, 0x6b, 0xae, 0x75, 0x8d, 0xfd, 0x03, 0x42, 0xbf, 0x86, 0x31, 0xc3, 0x54,
+	0xc8, 0x85, 0xcd, 0x88, 0x76, 0xb7, 0x26, 0x6a, 0x71, 0xe1, 0x3a, 0x84, 0xc7, 0x1b, 0x07, 0xc4,
+	0x0c, 0xdd, 0xf2, 0x9e, 0x9c, 0x71, 0x4d, 0xa7, 0x1d, 0x35, 0xf3, 0xf1, 0x88, 0x56, 0x59, 0xc6,
+	0xec, 0x01, 0xa1, 0x8f, 0x3d, 0x1a, 0xb5, 0x49, 0xdf, 0xee, 0x83, 0x8f, 0x4b, 0xf7, 0x4e, 0x9f,
+	0xed, 0xc0, 0x2b, 0xde, 0xa0, 0x47, 0xb0, 0xd7, 0x3b, 0x03, 0xfa, 0x89, 0x57, 0x5e, 0x7f, 0x1f,
+	0x6b, 0x6b, 0x3f, 0x71, 0x7f, 0x50, 0xbe, 0xfa, 0x6b, 0x00, 0xc8, 0x68, 0xca, 0x51, 0xbc, 0x08,
+	0x00, 0x00,
 }
@@ -0,0 +1,297 @@
+// Package ratelimit keeps a single client from starving the others. Every client, identified
+// by its authenticated principal or else its IP address, gets a token bucket of calls, a cap on
+// concurrent calls per method and a cap on the rate of messages it sends on each stream.
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/auth"
+)
+
+// sweepInterval is how often idle clients are forgotten
+const sweepInterval = time.Minute
+
+// ForwardedForMetadata names the client a trusted proxy calls on behalf of, see Options.TrustForwardedFor
+const ForwardedForMetadata = "x-forwarded-for"
+
+// concurrencyRetry is the retry delay suggested to callers over their concurrency cap,
+// there is no telling when one of their other calls will finish
+const concurrencyRetry = time.Second
+
+// Options configures a Limiter, a zero value disables the matching limit
+type Options struct {
+	// Rate and Burst bound the calls each client may start, in calls per second
+	Rate  float64
+	Burst int
+	// MaxConcurrent caps the calls each client may have open per method. Keys are the full
+	// gRPC name ( "/protos.RouteGuide/RouteChat" ), the bare method name ( "RouteChat" ) or "*".
+	MaxConcurrent map[string]int
+	// StreamRate and StreamBurst bound the messages a client may send on each stream, in messages per second
+	StreamRate  float64
+	StreamBurst int
+	// TrustForwardedFor reports whether a peer is a proxy, e.g. the gateway's in-memory connection,
+	// whose x-forwarded-for metadata names the client it calls for. Unauthenticated callers behind
+	// it then get limits of their own rather than sharing the proxy's. Nil trusts no peer.
+	TrustForwardedFor func(addr net.Addr) bool
+}
+
+// Limiter enforces Options through its interceptors
+type Limiter struct {
+	opts Options
+	now  func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	inflight  map[string]int
+	lastSweep time.Time
+
+	rejected      *prometheus.CounterVec
+	inflightCalls *prometheus.GaugeVec
+}
+
+// New creates a Limiter enforcing opts
+func New(opts Options) *Limiter {
+	return &Limiter{
+		opts:     opts,
+		now:      time.Now,
+		buckets:  make(map[string]*bucket),
+		inflight: make(map[string]int),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ratelimit_rejected_total",
+			Help: "Calls and stream messages rejected by the limiter, by method and limit.",
+		}, []string{"method", "limit"}),
+		inflightCalls: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ratelimit_inflight_calls",
+			Help: "Calls currently counted against the concurrency caps, by method.",
+		}, []string{"method"}),
+	}
+}
+
+// Register exports the limiter state on reg, e.g. the metrics.Metrics registry
+func (l *Limiter) Register(reg prometheus.Registerer) {
+	reg.MustRegister(l.rejected, l.inflightCalls, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ratelimit_tracked_clients",
+		Help: "Clients with a partly drained token bucket.",
+	}, func() float64 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return float64(len(l.buckets))
+	}))
+}
+
+// ParseConcurrency parses "RouteChat=10,ListFeatures=4" into Options.MaxConcurrent
+func ParseConcurrency(s string) (map[string]int, error) {
+	caps := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("ratelimit: %q is not method=limit", pair)
+		}
+		n, err := strconv.Atoi(pair[i+1:])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("ratelimit: bad limit in %q", pair)
+		}
+		caps[pair[:i]] = n
+	}
+	return caps, nil
+}
+
+// UnaryServerInterceptor applies the call rate and concurrency caps to unary RPCs.
+// It must run after the auth interceptors so clients are keyed by principal.
+// Methods whose full name starts with one of the exempt prefixes are never limited.
+func (l *Limiter) UnaryServerInterceptor(exempt ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isExempt(info.FullMethod, exempt) {
+			return handler(ctx, req)
+		}
+		release, err := l.admit(l.clientKey(ctx), info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor applies the call rate and concurrency caps to streaming RPCs,
+// and the message rate cap to what the client sends on them. See UnaryServerInterceptor for exempt.
+func (l *Limiter) StreamServerInterceptor(exempt ...string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isExempt(info.FullMethod, exempt) {
+			return handler(srv, ss)
+		}
+		release, err := l.admit(l.clientKey(ss.Context()), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer release()
+		if l.opts.StreamRate <= 0 {
+			return handler(srv, ss)
+		}
+		return handler(srv, &limitedStream{
+			ServerStream: ss,
+			limiter:      l,
+			method:       info.FullMethod,
+			bucket:       newBucket(l.opts.StreamRate, l.opts.StreamBurst, l.now()),
+		})
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// admit checks the rate and concurrency caps of client for fullMethod.
+// The returned function must be called once the call completes.
+func (l *Limiter) admit(client, fullMethod string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	if l.opts.Rate > 0 {
+		b, ok := l.buckets[client]
+		if !ok {
+			b = newBucket(l.opts.Rate, l.opts.Burst, now)
+			l.buckets[client] = b
+		}
+		if ok, wait := b.take(now); !ok {
+			l.rejected.WithLabelValues(fullMethod, "rate").Inc()
+			return nil, exhausted(wait, "rate limit exceeded, retry in %v", wait)
+		}
+	}
+
+	limit, capped := l.maxConcurrent(fullMethod)
+	if !capped {
+		return func() {}, nil
+	}
+	key := client + " " + fullMethod
+	if l.inflight[key] >= limit {
+		l.rejected.WithLabelValues(fullMethod, "concurrency").Inc()
+		return nil, exhausted(concurrencyRetry, "at most %d concurrent %s calls per client", limit, fullMethod)
+	}
+	l.inflight[key]++
+	l.inflightCalls.WithLabelValues(fullMethod).Inc()
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.inflight[key]--; l.inflight[key] <= 0 {
+			delete(l.inflight, key)
+		}
+		l.inflightCalls.WithLabelValues(fullMethod).Dec()
+	}, nil
+}
+
+// maxConcurrent finds the concurrency cap for fullMethod, the most specific key wins
+func (l *Limiter) maxConcurrent(fullMethod string) (int, bool) {
+	name := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	for _, key := range []string{fullMethod, name, "*"} {
+		if limit, ok := l.opts.MaxConcurrent[key]; ok {
+			return limit, true
+		}
+	}
+	return 0, false
+}
+
+// sweep forgets the buckets of clients idle long enough to have refilled. mu must be held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// exhausted builds a ResourceExhausted status telling the caller when to retry
+func exhausted(wait time.Duration, format string, a ...interface{}) error {
+	st := status.Newf(codes.ResourceExhausted, format, a...)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(wait)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// clientKey identifies the caller by principal, falling back to the peer's IP address, or the
+// forwarded address when the peer is a trusted proxy
+func (l *Limiter) clientKey(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return "principal:" + p.Name
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if l.opts.TrustForwardedFor != nil && l.opts.TrustForwardedFor(p.Addr) {
+			if forwarded := forwardedFor(ctx); forwarded != "" {
+				return "ip:" + forwarded
+			}
+		}
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+		return "ip:" + addr
+	}
+	return "unknown"
+}
+
+// forwardedFor is the client named by the x-forwarded-for metadata, the first address of the first value
+func forwardedFor(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	vals := md[ForwardedForMetadata]
+	if len(vals) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(strings.Split(vals[0], ",")[0])
+}
+
+// isExempt checks if fullMethod starts with one of the exempt prefixes
+func isExempt(fullMethod string, exempt []string) bool {
+	for _, prefix := range exempt {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedStream caps the rate of messages received on a stream
+type limitedStream struct {
+	grpc.ServerStream
+	limiter *Limiter
+	method  string
+	bucket  *bucket
+}
+
+func (s *limitedStream) RecvMsg(msg interface{}) error {
+	if err := s.ServerStream.RecvMsg(msg); err != nil {
+		return err
+	}
+	// gRPC allows a single receiving goroutine per stream, so the bucket needs no lock
+	if ok, wait := s.bucket.take(s.limiter.now()); !ok {
+		s.limiter.rejected.WithLabelValues(s.method, "stream").Inc()
+		return exhausted(wait, "stream message rate exceeded, retry in %v", wait)
+	}
+	return nil
+}
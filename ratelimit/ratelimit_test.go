@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/auth"
+)
+
+func TestClientKey(t *testing.T) {
+	trustBufconn := func(addr net.Addr) bool { return addr.Network() == "bufconn" }
+	tests := []struct {
+		name      string
+		trust     func(net.Addr) bool
+		addr      net.Addr
+		forwarded []string
+		principal string
+		want      string
+	}{
+		{
+			name: "peer address",
+			addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000},
+			want: "ip:10.0.0.1",
+		},
+		{
+			name:      "principal wins over the address",
+			trust:     trustBufconn,
+			addr:      bufconnAddr{},
+			forwarded: []string{"192.0.2.7"},
+			principal: "alice",
+			want:      "principal:alice",
+		},
+		{
+			name:      "forwarded by a trusted proxy",
+			trust:     trustBufconn,
+			addr:      bufconnAddr{},
+			forwarded: []string{"192.0.2.7"},
+			want:      "ip:192.0.2.7",
+		},
+		{
+			name:      "first address of a forwarded chain",
+			trust:     trustBufconn,
+			addr:      bufconnAddr{},
+			forwarded: []string{"192.0.2.7, 10.0.0.2"},
+			want:      "ip:192.0.2.7",
+		},
+		{
+			name:      "forwarded by an untrusted peer",
+			trust:     trustBufconn,
+			addr:      &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000},
+			forwarded: []string{"192.0.2.7"},
+			want:      "ip:10.0.0.1",
+		},
+		{
+			name:      "forwarded without any trusted proxy",
+			addr:      bufconnAddr{},
+			forwarded: []string{"192.0.2.7"},
+			want:      "ip:bufconn",
+		},
+		{
+			name:  "trusted proxy calling for itself",
+			trust: trustBufconn,
+			addr:  bufconnAddr{},
+			want:  "ip:bufconn",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(Options{TrustForwardedFor: tt.trust})
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: tt.addr})
+			if tt.forwarded != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.MD{ForwardedForMetadata: tt.forwarded})
+			}
+			if tt.principal != "" {
+				ctx = auth.NewContext(ctx, &auth.Principal{Name: tt.principal})
+			}
+			if got := l.clientKey(ctx); got != tt.want {
+				t.Errorf("clientKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Callers behind the gateway each get a bucket of their own instead of sharing the gateway's.
+func TestForwardedCallersHaveSeparateBuckets(t *testing.T) {
+	l := New(Options{
+		Rate:              0.001,
+		Burst:             1,
+		TrustForwardedFor: func(addr net.Addr) bool { return addr.Network() == "bufconn" },
+	})
+	interceptor := l.UnaryServerInterceptor()
+	call := func(client string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: bufconnAddr{}})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(ForwardedForMetadata, client))
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/protos.RouteGuide/GetFeature"},
+			func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+		return err
+	}
+	if err := call("192.0.2.1"); err != nil {
+		t.Fatalf("first call of 192.0.2.1: %v", err)
+	}
+	if err := call("192.0.2.2"); err != nil {
+		t.Errorf("first call of 192.0.2.2 = %v, want it admitted", err)
+	}
+	if err := call("192.0.2.1"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second call of 192.0.2.1 = %v, want ResourceExhausted", err)
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// bufconnAddr is the address bufconn connections report
+type bufconnAddr struct{}
+
+func (bufconnAddr) Network() string { return "bufconn" }
+func (bufconnAddr) String() string  { return "bufconn" }
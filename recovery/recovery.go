@@ -0,0 +1,57 @@
+// Package recovery turns a panic in an RPC handler into a codes.Internal status for the
+// offending call instead of letting it take the whole server down.
+package recovery
+
+import (
+	"runtime/debug"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.uber.org/zap"
+)
+
+// UnaryServerInterceptor recovers panics in unary handlers.
+// onPanic, when not nil, is called with the full method name of every recovered call, e.g. to count them.
+func UnaryServerInterceptor(logger *zap.Logger, onPanic func(fullMethod string)) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(logger, onPanic, info.FullMethod, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor recovers panics in streaming handlers, see UnaryServerInterceptor for onPanic.
+// Only the handler's own goroutine is covered, goroutines it starts must not panic.
+func StreamServerInterceptor(logger *zap.Logger, onPanic func(fullMethod string)) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(logger, onPanic, info.FullMethod, r)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// recovered logs the panic with its stack and returns the status sent to the caller.
+// The panic value is not sent, it may hold details the caller has no business seeing.
+func recovered(logger *zap.Logger, onPanic func(string), fullMethod string, r interface{}) error {
+	logger.Error("recovered from panic",
+		zap.String("method", fullMethod),
+		zap.Any("panic", r),
+		zap.ByteString("stack", debug.Stack()),
+	)
+	if onPanic != nil {
+		onPanic(fullMethod)
+	}
+	return status.Errorf(codes.Internal, "internal error")
+}
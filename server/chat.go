@@ -0,0 +1,81 @@
+package server
+
+import (
+	"sync"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// chatter is an open RouteChat stream. Notes are queued for it by any chat and sent, in the
+// order they were queued, by its own RouteChat call.
+type chatter struct {
+	// sent holds every note queued so far, no note is sent to a stream twice. Guarded by notesMu.
+	sent map[*protos.RouteNote]bool
+
+	mu    sync.Mutex
+	queue []*protos.RouteNote
+	// wake is signalled whenever notes are queued
+	wake chan struct{}
+}
+
+// ------ Unexported helpers ------ //
+
+// joinChat registers a new chatter, notes left from now on are queued for it
+func (s *RouteGuideServerImpl) joinChat() *chatter {
+	c := &chatter{sent: make(map[*protos.RouteNote]bool), wake: make(chan struct{}, 1)}
+	s.notesMu.Lock()
+	defer s.notesMu.Unlock()
+	if s.chatters == nil {
+		s.chatters = make(map[*chatter]struct{})
+	}
+	s.chatters[c] = struct{}{}
+	return c
+}
+
+func (s *RouteGuideServerImpl) leaveChat(c *chatter) {
+	s.notesMu.Lock()
+	defer s.notesMu.Unlock()
+	delete(s.chatters, c)
+}
+
+// leaveNote stores a note left by c. c is answered with the notes at the location it wasn't sent
+// yet, ending with the note itself, and every other chatter is sent the note.
+// Queueing under notesMu keeps every chatter's notes in the order they were stored.
+func (s *RouteGuideServerImpl) leaveNote(c *chatter, in *protos.RouteNote) {
+	key := serialize(in.Location)
+	s.notesMu.Lock()
+	defer s.notesMu.Unlock()
+	s.RouteNotes[key] = append(s.RouteNotes[key], in)
+	for _, note := range s.RouteNotes[key] {
+		c.push(note)
+	}
+	for other := range s.chatters {
+		if other != c {
+			other.push(in)
+		}
+	}
+}
+
+// push queues a note unless it was sent already, the caller holds notesMu
+func (c *chatter) push(note *protos.RouteNote) {
+	if c.sent[note] {
+		return
+	}
+	c.sent[note] = true
+	c.mu.Lock()
+	c.queue = append(c.queue, note)
+	c.mu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the queued notes and empties the queue
+func (c *chatter) take() []*protos.RouteNote {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	notes := c.queue
+	c.queue = nil
+	return notes
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"testing"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// Every chatter is sent every note once: notes left by others as they arrive, and the notes at a
+// location it wasn't sent yet when it leaves a note there.
+func TestLeaveNote(t *testing.T) {
+	s := &RouteGuideServerImpl{RouteNotes: make(map[string][]*protos.RouteNote)}
+	here := &protos.Point{Latitude: 1, Longitude: 2}
+	first := &protos.RouteNote{Location: here, Message: "first"}
+	second := &protos.RouteNote{Location: here, Message: "second"}
+	late := &protos.RouteNote{Location: here, Message: "late"}
+	elsewhere := &protos.RouteNote{Location: &protos.Point{Latitude: 3, Longitude: 4}, Message: "elsewhere"}
+
+	alice, bob := s.joinChat(), s.joinChat()
+	s.leaveNote(alice, first)
+	expectQueued(t, "alice", alice, first)
+	expectQueued(t, "bob", bob, first)
+
+	s.leaveNote(bob, second)
+	expectQueued(t, "bob", bob, second)
+	expectQueued(t, "alice", alice, second)
+
+	// a chatter joining later is answered with everything left at the location
+	carol := s.joinChat()
+	s.leaveNote(carol, late)
+	expectQueued(t, "carol", carol, first, second, late)
+	expectQueued(t, "alice", alice, late)
+	expectQueued(t, "bob", bob, late)
+
+	s.leaveChat(bob)
+	s.leaveNote(alice, elsewhere)
+	expectQueued(t, "alice", alice, elsewhere)
+	expectQueued(t, "carol", carol, elsewhere)
+	expectQueued(t, "bob", bob)
+}
+
+// ------ Unexported helpers ------ //
+
+// expectQueued takes the notes queued for c and compares them in order
+func expectQueued(t *testing.T, name string, c *chatter, want ...*protos.RouteNote) {
+	t.Helper()
+	select {
+	case <-c.wake:
+		if len(want) == 0 {
+			t.Errorf("%s was woken without notes to send", name)
+		}
+	default:
+		if len(want) > 0 {
+			t.Errorf("%s was not woken", name)
+		}
+	}
+	got := c.take()
+	if len(got) != len(want) {
+		t.Fatalf("%s was sent %v, want %v", name, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s was sent %v as note %d, want %v", name, got[i], i, want[i])
+		}
+	}
+}
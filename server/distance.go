@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+	"math"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// DistanceMode selects the formula used to measure the distance between two points.
+type DistanceMode int
+
+const (
+	// Haversine treats the earth as a sphere. It is cheap and good to roughly 0.5%.
+	Haversine DistanceMode = iota
+	// Vincenty solves the inverse geodesic problem on the WGS-84 ellipsoid and is
+	// accurate to well under a millimetre, at the cost of an iterative solve.
+	Vincenty
+)
+
+// ParseDistanceMode converts a flag value ( "haversine" or "vincenty" ) to a DistanceMode.
+func ParseDistanceMode(mode string) (DistanceMode, error) {
+	switch mode {
+	case "", "haversine":
+		return Haversine, nil
+	case "vincenty":
+		return Vincenty, nil
+	}
+	return Haversine, fmt.Errorf("unknown distance mode %q", mode)
+}
+
+// String returns the flag value for the mode
+func (m DistanceMode) String() string {
+	switch m {
+	case Vincenty:
+		return "vincenty"
+	default:
+		return "haversine"
+	}
+}
+
+// Distance returns the distance in metres between two points using the mode's formula.
+func (m DistanceMode) Distance(p1 *protos.Point, p2 *protos.Point) float64 {
+	if m == Vincenty {
+		return calcVincentyDistance(p1, p2)
+	}
+	return calcDistance(p1, p2)
+}
+
+// ------ Unexported helpers ------ //
+
+// cordFactor is the E7 scaling used by protos.Point
+const cordFactor float64 = 1e7
+
+// toRadians converts a number to radian
+func toRadians(num float64) float64 {
+	return num * math.Pi / float64(180)
+}
+
+// calcDistance calculates the distance between two points using the "haversine" formula.
+// This code was taken from http://www.movable-type.co.uk/scripts/latlong.html.
+func calcDistance(p1 *protos.Point, p2 *protos.Point) float64 {
+	const R float64 = float64(6371000) // metres
+	lat1 := float64(p1.Latitude) / cordFactor
+	lat2 := float64(p2.Latitude) / cordFactor
+	lng1 := float64(p1.Longitude) / cordFactor
+	lng2 := float64(p2.Longitude) / cordFactor
+	φ1 := toRadians(lat1)
+	φ2 := toRadians(lat2)
+	Δφ := toRadians(lat2 - lat1)
+	Δλ := toRadians(lng2 - lng1)
+
+	a := math.Sin(Δφ/2)*math.Sin(Δφ/2) +
+		math.Cos(φ1)*math.Cos(φ2)*
+			math.Sin(Δλ/2)*math.Sin(Δλ/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return R * c
+}
+
+// calcVincentyDistance calculates the distance between two points on the WGS-84 ellipsoid
+// using Vincenty's inverse formula. See http://www.movable-type.co.uk/scripts/latlong-vincenty.html.
+// The iteration does not converge for nearly antipodal points, in which case we fall back
+// to the haversine distance rather than return garbage.
+func calcVincentyDistance(p1 *protos.Point, p2 *protos.Point) float64 {
+	const a float64 = 6378137           // semi-major axis in metres
+	const f float64 = 1 / 298.257223563 // flattening
+	const b float64 = (1 - f) * a       // semi-minor axis in metres
+
+	φ1 := toRadians(float64(p1.Latitude) / cordFactor)
+	φ2 := toRadians(float64(p2.Latitude) / cordFactor)
+	L := toRadians(float64(p2.Longitude)/cordFactor - float64(p1.Longitude)/cordFactor)
+
+	// reduced latitudes
+	U1 := math.Atan((1 - f) * math.Tan(φ1))
+	U2 := math.Atan((1 - f) * math.Tan(φ2))
+	sinU1, cosU1 := math.Sin(U1), math.Cos(U1)
+	sinU2, cosU2 := math.Sin(U2), math.Cos(U2)
+
+	λ := L
+	var sinσ, cosσ, σ, cos2α, cos2σm float64
+	converged := false
+	for i := 0; i < 200; i++ {
+		sinλ, cosλ := math.Sin(λ), math.Cos(λ)
+		sinσ = math.Sqrt((cosU2*sinλ)*(cosU2*sinλ) +
+			(cosU1*sinU2-sinU1*cosU2*cosλ)*(cosU1*sinU2-sinU1*cosU2*cosλ))
+		if sinσ == 0 {
+			return 0 // coincident points
+		}
+		cosσ = sinU1*sinU2 + cosU1*cosU2*cosλ
+		σ = math.Atan2(sinσ, cosσ)
+		sinα := cosU1 * cosU2 * sinλ / sinσ
+		cos2α = 1 - sinα*sinα
+		cos2σm = 0
+		if cos2α != 0 { // both points on the equator
+			cos2σm = cosσ - 2*sinU1*sinU2/cos2α
+		}
+		C := f / 16 * cos2α * (4 + f*(4-3*cos2α))
+		λPrev := λ
+		λ = L + (1-C)*f*sinα*(σ+C*sinσ*(cos2σm+C*cosσ*(-1+2*cos2σm*cos2σm)))
+		if math.Abs(λ-λPrev) < 1e-12 {
+			converged = true
+			break
+		}
+	}
+	if !converged || math.Abs(λ) > math.Pi {
+		return calcDistance(p1, p2)
+	}
+
+	u2 := cos2α * (a*a - b*b) / (b * b)
+	A := 1 + u2/16384*(4096+u2*(-768+u2*(320-175*u2)))
+	B := u2 / 1024 * (256 + u2*(-128+u2*(74-47*u2)))
+	Δσ := B * sinσ * (cos2σm + B/4*(cosσ*(-1+2*cos2σm*cos2σm)-
+		B/6*cos2σm*(-3+4*sinσ*sinσ)*(-3+4*cos2σm*cos2σm)))
+
+	return b * A * (σ - Δσ)
+}
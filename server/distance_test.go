@@ -0,0 +1,118 @@
+package server
+
+import (
+	"math"
+	"testing"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// point builds a protos.Point from decimal degrees
+func point(lat, lng float64) *protos.Point {
+	return &protos.Point{Latitude: int32(math.Round(lat * cordFactor)), Longitude: int32(math.Round(lng * cordFactor))}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name      string
+		p1, p2    *protos.Point
+		haversine float64
+		vincenty  float64
+		tolerance float64
+	}{
+		{
+			name:      "coincident points",
+			p1:        point(10, 20),
+			p2:        point(10, 20),
+			tolerance: 1e-9,
+		},
+		{
+			// a degree of arc on the sphere is 2πR/360, on the ellipsoid's equator 2πa/360
+			name:      "one degree along the equator",
+			p1:        point(0, 0),
+			p2:        point(0, 1),
+			haversine: 111194.927,
+			vincenty:  111319.491,
+			tolerance: 0.01,
+		},
+		{
+			// Vincenty's own worked example, Flinders Peak to Buninyong
+			name:      "Flinders Peak to Buninyong",
+			p1:        point(-37.95103342, 144.42486789),
+			p2:        point(-37.65282114, 143.92649553),
+			haversine: 54925.44,
+			vincenty:  54972.271,
+			tolerance: 0.05,
+		},
+		{
+			name:      "London to New York",
+			p1:        point(51.5007, -0.1246),
+			p2:        point(40.6892, -74.0445),
+			haversine: 5574840.46,
+			vincenty:  5589857.37,
+			tolerance: 0.05,
+		},
+		{
+			// the iteration doesn't converge this close to antipodal, Vincenty falls back to haversine
+			name:      "nearly antipodal",
+			p1:        point(0, 0),
+			p2:        point(0.5, 179.7),
+			haversine: 19950249.79,
+			vincenty:  19950249.79,
+			tolerance: 0.05,
+		},
+		{
+			name:      "antipodal on the equator",
+			p1:        point(0, 0),
+			p2:        point(0, 180),
+			haversine: 20015086.80,
+			vincenty:  20015086.80,
+			tolerance: 0.05,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Haversine.Distance(tt.p1, tt.p2); math.Abs(got-tt.haversine) > tt.tolerance {
+				t.Errorf("haversine = %.3f, want %.3f", got, tt.haversine)
+			}
+			if got := Vincenty.Distance(tt.p1, tt.p2); math.Abs(got-tt.vincenty) > tt.tolerance {
+				t.Errorf("vincenty = %.3f, want %.3f", got, tt.vincenty)
+			}
+		})
+	}
+}
+
+func TestVincentyFallsBackWhenNotConverging(t *testing.T) {
+	p1, p2 := point(0, 0), point(0.5, 179.7)
+	if got, want := calcVincentyDistance(p1, p2), calcDistance(p1, p2); got != want {
+		t.Errorf("calcVincentyDistance = %f, want the haversine distance %f", got, want)
+	}
+	// slightly further from antipodal it converges and differs from the sphere
+	p2 = point(0.5, 179.5)
+	if got, sphere := calcVincentyDistance(p1, p2), calcDistance(p1, p2); got == sphere {
+		t.Errorf("calcVincentyDistance = %f, expected a converged ellipsoidal distance", got)
+	}
+}
+
+func TestParseDistanceMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    DistanceMode
+		wantErr bool
+	}{
+		{in: "", want: Haversine},
+		{in: "haversine", want: Haversine},
+		{in: "vincenty", want: Vincenty},
+		{in: "euclid", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDistanceMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDistanceMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseDistanceMode(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
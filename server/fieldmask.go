@@ -0,0 +1,68 @@
+package server
+
+import (
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// featurePaths are the Feature field paths a read_mask may name
+var featurePaths = map[string]bool{
+	"name":               true,
+	"location":           true,
+	"location.latitude":  true,
+	"location.longitude": true,
+	"tags":               true,
+	"category":           true,
+	"properties":         true,
+}
+
+// validateFeatureMask returns an InvalidArgument status if the mask names a path Feature does not have.
+func validateFeatureMask(mask *field_mask.FieldMask) error {
+	for _, path := range mask.GetPaths() {
+		if !featurePaths[path] {
+			return status.Errorf(codes.InvalidArgument, "read_mask: unknown Feature field %q", path)
+		}
+	}
+	return nil
+}
+
+// applyFeatureMask returns a copy of feature holding only the fields named by mask.
+// The saved feature is never modified, an empty mask returns it as is.
+func applyFeatureMask(feature *protos.Feature, mask *field_mask.FieldMask) *protos.Feature {
+	if len(mask.GetPaths()) == 0 {
+		return feature
+	}
+	trimmed := &protos.Feature{}
+	for _, path := range mask.GetPaths() {
+		switch path {
+		case "name":
+			trimmed.Name = feature.Name
+		case "location":
+			trimmed.Location = feature.Location
+		case "tags":
+			trimmed.Tags = feature.Tags
+		case "category":
+			trimmed.Category = feature.Category
+		case "properties":
+			trimmed.Properties = feature.Properties
+		case "location.latitude", "location.longitude":
+			if feature.Location == nil {
+				continue
+			}
+			if trimmed.Location == nil {
+				trimmed.Location = &protos.Point{}
+			} else if trimmed.Location == feature.Location {
+				continue // the whole location was already asked for
+			}
+			if path == "location.latitude" {
+				trimmed.Location.Latitude = feature.Location.Latitude
+			} else {
+				trimmed.Location.Longitude = feature.Location.Longitude
+			}
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+func TestValidateFeatureMask(t *testing.T) {
+	tests := []struct {
+		paths []string
+		want  codes.Code
+	}{
+		{paths: nil},
+		{paths: []string{"name", "location", "tags", "category", "properties"}},
+		{paths: []string{"location.latitude", "location.longitude"}},
+		{paths: []string{"name", "description"}, want: codes.InvalidArgument},
+		{paths: []string{"location.altitude"}, want: codes.InvalidArgument},
+		{paths: []string{"Name"}, want: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		err := validateFeatureMask(&field_mask.FieldMask{Paths: tt.paths})
+		if status.Code(err) != tt.want {
+			t.Errorf("validateFeatureMask(%q) = %v, want %s", tt.paths, err, tt.want)
+		}
+	}
+	if err := validateFeatureMask(nil); err != nil {
+		t.Errorf("validateFeatureMask(nil) = %v", err)
+	}
+}
+
+func TestApplyFeatureMask(t *testing.T) {
+	feature := &protos.Feature{
+		Name:       "Patriots Path",
+		Location:   &protos.Point{Latitude: 407838351, Longitude: -746143763},
+		Tags:       []string{"trail"},
+		Category:   "park",
+		Properties: map[string]string{"surface": "gravel"},
+	}
+	saved := proto.Clone(feature)
+	tests := []struct {
+		name  string
+		paths []string
+		want  *protos.Feature
+	}{
+		{name: "no mask", want: feature},
+		{name: "name", paths: []string{"name"}, want: &protos.Feature{Name: "Patriots Path"}},
+		{
+			name:  "attributes",
+			paths: []string{"tags", "category", "properties"},
+			want:  &protos.Feature{Tags: []string{"trail"}, Category: "park", Properties: map[string]string{"surface": "gravel"}},
+		},
+		{name: "latitude", paths: []string{"location.latitude"}, want: &protos.Feature{Location: &protos.Point{Latitude: 407838351}}},
+		{name: "longitude", paths: []string{"location.longitude"}, want: &protos.Feature{Location: &protos.Point{Longitude: -746143763}}},
+		{
+			name:  "both sub paths",
+			paths: []string{"location.longitude", "location.latitude"},
+			want:  &protos.Feature{Location: &protos.Point{Latitude: 407838351, Longitude: -746143763}},
+		},
+		{
+			name:  "location and a sub path",
+			paths: []string{"location", "location.latitude"},
+			want:  &protos.Feature{Location: &protos.Point{Latitude: 407838351, Longitude: -746143763}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mask *field_mask.FieldMask
+			if tt.paths != nil {
+				mask = &field_mask.FieldMask{Paths: tt.paths}
+			}
+			got := applyFeatureMask(feature, mask)
+			if !proto.Equal(got, tt.want) {
+				t.Errorf("applyFeatureMask(%q) = %v, want %v", tt.paths, got, tt.want)
+			}
+			// scribbling on the result must not reach the saved feature
+			if got != feature && got.Location != nil && got.Location != feature.Location {
+				got.Location.Latitude++
+			}
+			if !proto.Equal(feature, saved) {
+				t.Fatalf("applyFeatureMask(%q) changed the saved feature to %v", tt.paths, feature)
+			}
+		})
+	}
+
+	// sub paths of a feature without a location leave it out
+	got := applyFeatureMask(&protos.Feature{Name: "nowhere"}, &field_mask.FieldMask{Paths: []string{"name", "location.latitude"}})
+	if !proto.Equal(got, &protos.Feature{Name: "nowhere"}) {
+		t.Errorf("applyFeatureMask without a location = %v", got)
+	}
+}
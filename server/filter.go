@@ -0,0 +1,37 @@
+package server
+
+import (
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// matchesFilter checks the feature has every attribute the filter asks for.
+// A nil or empty filter matches everything.
+func matchesFilter(feature *protos.Feature, filter *protos.FeatureFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.Category != "" && filter.Category != feature.Category {
+		return false
+	}
+	for _, tag := range filter.Tags {
+		if !hasTag(feature, tag) {
+			return false
+		}
+	}
+	for key, want := range filter.Properties {
+		if got, ok := feature.Properties[key]; !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTag checks if the feature carries the tag
+func hasTag(feature *protos.Feature, tag string) bool {
+	for _, t := range feature.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+func TestMatchesFilter(t *testing.T) {
+	feature := &protos.Feature{
+		Name:       "Patriots Path",
+		Category:   "park",
+		Tags:       []string{"trail", "dogs-allowed"},
+		Properties: map[string]string{"surface": "gravel", "opening_hours": "24/7"},
+	}
+	tests := []struct {
+		name   string
+		filter *protos.FeatureFilter
+		want   bool
+	}{
+		{name: "nil filter", want: true},
+		{name: "empty filter", filter: &protos.FeatureFilter{}, want: true},
+		{name: "category", filter: &protos.FeatureFilter{Category: "park"}, want: true},
+		{name: "other category", filter: &protos.FeatureFilter{Category: "restaurant"}},
+		{name: "one tag", filter: &protos.FeatureFilter{Tags: []string{"trail"}}, want: true},
+		{name: "every tag", filter: &protos.FeatureFilter{Tags: []string{"dogs-allowed", "trail"}}, want: true},
+		{name: "one tag missing", filter: &protos.FeatureFilter{Tags: []string{"trail", "wheelchair-accessible"}}},
+		{name: "property", filter: &protos.FeatureFilter{Properties: map[string]string{"surface": "gravel"}}, want: true},
+		{name: "other property value", filter: &protos.FeatureFilter{Properties: map[string]string{"surface": "paved"}}},
+		{name: "missing property", filter: &protos.FeatureFilter{Properties: map[string]string{"fee": ""}}},
+		{
+			name: "everything",
+			filter: &protos.FeatureFilter{
+				Category:   "park",
+				Tags:       []string{"trail"},
+				Properties: map[string]string{"surface": "gravel", "opening_hours": "24/7"},
+			},
+			want: true,
+		},
+		{
+			name: "everything but one property",
+			filter: &protos.FeatureFilter{
+				Category:   "park",
+				Tags:       []string{"trail"},
+				Properties: map[string]string{"surface": "gravel", "opening_hours": "sunrise-sunset"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesFilter(feature, tt.filter); got != tt.want {
+				t.Errorf("matchesFilter(%v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
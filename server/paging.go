@@ -0,0 +1,24 @@
+package server
+
+import (
+	"sort"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/pagetoken"
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+// DefaultMaxListResults is the per-call bound on ListFeatures and NearestFeatures used when none is configured.
+const DefaultMaxListResults = 1000
+
+// defaultNearestResults is the number of features NearestFeatures sends when max_results is zero.
+const defaultNearestResults = 10
+
+// sortByLocation returns a copy of features in ListFeatures order.
+func sortByLocation(features []*protos.Feature) []*protos.Feature {
+	sorted := make([]*protos.Feature, len(features))
+	copy(sorted, features)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return pagetoken.Of(sorted[i]).Less(pagetoken.Of(sorted[j]))
+	})
+	return sorted
+}
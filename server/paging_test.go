@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/pagetoken"
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+func TestListFeaturesPages(t *testing.T) {
+	s := &RouteGuideServerImpl{MaxListResults: 4}
+	s.SetFeatures(grid(3))
+	tests := []struct {
+		name          string
+		maxResults    int32
+		want          []string
+		wantNext      bool
+		wantTruncated bool
+	}{
+		{name: "bound", want: []string{"0,0", "0,1", "0,2", "1,0"}, wantNext: true, wantTruncated: true},
+		{name: "limit equals the bound", maxResults: 4, want: []string{"0,0", "0,1", "0,2", "1,0"}, wantNext: true, wantTruncated: true},
+		{name: "limit above the bound", maxResults: 100, want: []string{"0,0", "0,1", "0,2", "1,0"}, wantNext: true, wantTruncated: true},
+		{name: "limit below the bound", maxResults: 3, want: []string{"0,0", "0,1", "0,2"}, wantNext: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &listStream{}
+			if err := s.ListFeatures(listAll(tt.maxResults, ""), stream); err != nil {
+				t.Fatalf("ListFeatures: %v", err)
+			}
+			if got := featureNames(stream.sent); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+			if next := stream.trailer.Get(pagetoken.NextPageTokenTrailer); (len(next) == 1) != tt.wantNext {
+				t.Errorf("next-page-token = %q, want one: %v", next, tt.wantNext)
+			}
+			if truncated := stream.trailer.Get(pagetoken.TruncatedTrailer); (len(truncated) == 1 && truncated[0] == "true") != tt.wantTruncated {
+				t.Errorf("truncated = %q, want it set: %v", truncated, tt.wantTruncated)
+			}
+		})
+	}
+
+	// a page ending on the last match has nothing to resume
+	s.SetFeatures(grid(2))
+	stream := &listStream{}
+	if err := s.ListFeatures(listAll(0, ""), stream); err != nil {
+		t.Fatalf("ListFeatures: %v", err)
+	}
+	if len(stream.sent) != 4 || stream.trailer != nil {
+		t.Errorf("sent %d features with trailer %v, want all 4 and no trailer", len(stream.sent), stream.trailer)
+	}
+}
+
+// Following the page tokens visits every feature once, in order.
+func TestListFeaturesResume(t *testing.T) {
+	s := &RouteGuideServerImpl{MaxListResults: 4}
+	features := grid(5)
+	// two features at one spot are told apart by name
+	features = append(features, &protos.Feature{Name: "2,2 again", Location: &protos.Point{Latitude: 2, Longitude: 2}})
+	s.SetFeatures(features)
+	for _, maxResults := range []int32{1, 2, 3, 0} {
+		var got []string
+		token := ""
+		for pages := 0; ; pages++ {
+			if pages > len(features) {
+				t.Fatalf("max_results %d: still paging after %d pages", maxResults, pages)
+			}
+			stream := &listStream{}
+			if err := s.ListFeatures(listAll(maxResults, token), stream); err != nil {
+				t.Fatalf("ListFeatures: %v", err)
+			}
+			got = append(got, featureNames(stream.sent)...)
+			next := stream.trailer.Get(pagetoken.NextPageTokenTrailer)
+			if len(next) == 0 {
+				break
+			}
+			token = next[0]
+		}
+		if want := featureNames(s.byLocation); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("max_results %d visited %q, want %q", maxResults, got, want)
+		}
+	}
+}
+
+func TestListFeaturesBadPageToken(t *testing.T) {
+	s := &RouteGuideServerImpl{}
+	s.SetFeatures(grid(2))
+	tokens := map[string]string{
+		"not base64":    "%%%",
+		"offset token":  base64.RawURLEncoding.EncodeToString([]byte("offset=10")),
+		"bad latitude":  base64.RawURLEncoding.EncodeToString([]byte("north 2 name")),
+		"out of range":  base64.RawURLEncoding.EncodeToString([]byte("9999999999 2 name")),
+		"padded base64": base64.URLEncoding.EncodeToString([]byte("1 2 name")),
+	}
+	for name, token := range tokens {
+		err := s.ListFeatures(listAll(0, token), &listStream{})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: ListFeatures = %v, want InvalidArgument", name, err)
+		}
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// listStream collects what ListFeatures sends
+type listStream struct {
+	protos.RouteGuide_ListFeaturesServer
+	sent    []*protos.Feature
+	trailer metadata.MD
+}
+
+func (s *listStream) Send(feature *protos.Feature) error {
+	s.sent = append(s.sent, feature)
+	return nil
+}
+
+func (s *listStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+// grid is n by n features named "lat,lng", latitude and longitude counting from 0
+func grid(n int32) []*protos.Feature {
+	var features []*protos.Feature
+	for lat := n - 1; lat >= 0; lat-- {
+		for lng := int32(0); lng < n; lng++ {
+			features = append(features, &protos.Feature{
+				Name:     fmt.Sprintf("%d,%d", lat, lng),
+				Location: &protos.Point{Latitude: lat, Longitude: lng},
+			})
+		}
+	}
+	return features
+}
+
+// listAll lists every feature of a grid
+func listAll(maxResults int32, pageToken string) *protos.ListFeaturesRequest {
+	return &protos.ListFeaturesRequest{
+		Lo:         &protos.Point{Latitude: 0, Longitude: 0},
+		Hi:         &protos.Point{Latitude: 100, Longitude: 100},
+		MaxResults: maxResults,
+		PageToken:  pageToken,
+	}
+}
+
+func featureNames(features []*protos.Feature) []string {
+	var names []string
+	for _, f := range features {
+		names = append(names, f.Name)
+	}
+	return names
+}
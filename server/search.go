@@ -0,0 +1,193 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+const (
+	defaultSearchResults = 10
+	maxSearchResults     = 100
+
+	// weights applied to a term depending on how it matched a query token
+	exactWeight  = 1.0
+	prefixWeight = 0.75
+	fuzzyWeight  = 0.5
+)
+
+// searchIndex is an in-process inverted index over feature names.
+// It is immutable once built, a reload builds a new index and swaps it in.
+type searchIndex struct {
+	features []*protos.Feature
+	// postings maps a term to the indexes of the features whose name contains it
+	postings map[string][]int
+	// terms holds every key of postings in sorted order for prefix lookups
+	terms []string
+}
+
+// newSearchIndex tokenises every feature name and builds the postings lists.
+func newSearchIndex(features []*protos.Feature) *searchIndex {
+	idx := &searchIndex{
+		features: features,
+		postings: make(map[string][]int),
+	}
+	for i, feature := range features {
+		seen := make(map[string]bool)
+		for _, term := range tokenize(feature.Name) {
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			idx.postings[term] = append(idx.postings[term], i)
+		}
+	}
+	for term := range idx.postings {
+		idx.terms = append(idx.terms, term)
+	}
+	sort.Strings(idx.terms)
+	return idx
+}
+
+// search returns the features matching query ranked by score. Each query token contributes
+// the weight of its best matching term in a feature, scaled by how rare that term is.
+func (idx *searchIndex) search(query string, bounds *protos.Rectangle, maxResults int) []*protos.SearchResult {
+	scores := make(map[int]float64)
+	for _, token := range tokenize(query) {
+		best := make(map[int]float64)
+		for term, weight := range idx.matchTerms(token) {
+			postings := idx.postings[term]
+			termScore := weight * idx.idf(len(postings))
+			for _, i := range postings {
+				if termScore > best[i] {
+					best[i] = termScore
+				}
+			}
+		}
+		for i, score := range best {
+			scores[i] += score
+		}
+	}
+
+	var results []*protos.SearchResult
+	for i, score := range scores {
+		feature := idx.features[i]
+		if bounds != nil && bounds.Lo != nil && bounds.Hi != nil && !inRange(feature.Location, bounds) {
+			continue
+		}
+		results = append(results, &protos.SearchResult{Feature: feature, Score: score})
+	}
+	// order by score, then by name so equal scores are stable between calls
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Feature.Name < results[j].Feature.Name
+	})
+	if len(results) > maxResults {
+		results = results[:maxResults]
+	}
+	return results
+}
+
+// matchTerms returns the indexed terms matching token along with their match weight.
+func (idx *searchIndex) matchTerms(token string) map[string]float64 {
+	matches := make(map[string]float64)
+	if _, ok := idx.postings[token]; ok {
+		matches[token] = exactWeight
+	}
+	// terms are sorted so every term with this prefix follows the insertion point
+	for i := sort.SearchStrings(idx.terms, token); i < len(idx.terms); i++ {
+		term := idx.terms[i]
+		if !strings.HasPrefix(term, token) {
+			break
+		}
+		if term != token {
+			matches[term] = prefixWeight
+		}
+	}
+	maxEdits := allowedEdits(token)
+	if maxEdits == 0 {
+		return matches
+	}
+	for _, term := range idx.terms {
+		if _, ok := matches[term]; ok {
+			continue
+		}
+		if d := editDistance(token, term, maxEdits); d <= maxEdits {
+			matches[term] = fuzzyWeight / float64(d)
+		}
+	}
+	return matches
+}
+
+// idf weights a term by the inverse of how many features contain it.
+func (idx *searchIndex) idf(docFreq int) float64 {
+	return 1 + float64(len(idx.features))/float64(1+docFreq)
+}
+
+// ------ Unexported helpers ------ //
+
+// tokenize lower cases s and splits it on anything that is not a letter or digit.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// allowedEdits is the fuzziness allowed for a token, short tokens must match exactly.
+func allowedEdits(token string) int {
+	switch n := len([]rune(token)); {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance computes the Levenshtein distance between a and b. It gives up early and
+// returns limit+1 once the distance is known to exceed limit.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
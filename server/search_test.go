@@ -0,0 +1,160 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+func TestSearchFeatures(t *testing.T) {
+	s := &RouteGuideServerImpl{}
+	s.SetFeatures([]*protos.Feature{
+		{Name: "Patriots Path, Mendham", Location: &protos.Point{Latitude: 1, Longitude: 1}},
+		{Name: "Mendhamville Road", Location: &protos.Point{Latitude: 2, Longitude: 2}},
+		{Name: "Mendam Lake", Location: &protos.Point{Latitude: 3, Longitude: 3}},
+		{Name: "Kingston Ferry", Location: &protos.Point{Latitude: 4, Longitude: 4}},
+	})
+	tests := []struct {
+		name string
+		req  *protos.SearchRequest
+		want []string
+	}{
+		// exact beats prefix beats fuzzy
+		{name: "ranked", req: &protos.SearchRequest{Query: "mendham"}, want: []string{"Patriots Path, Mendham", "Mendhamville Road", "Mendam Lake"}},
+		{name: "case and punctuation", req: &protos.SearchRequest{Query: "KINGSTON!"}, want: []string{"Kingston Ferry"}},
+		{name: "prefix", req: &protos.SearchRequest{Query: "kings"}, want: []string{"Kingston Ferry"}},
+		{name: "fuzzy", req: &protos.SearchRequest{Query: "mendam"}, want: []string{"Mendam Lake", "Patriots Path, Mendham"}},
+		{name: "short words match exactly", req: &protos.SearchRequest{Query: "rod"}},
+		{name: "every word counts", req: &protos.SearchRequest{Query: "mendham path"}, want: []string{"Patriots Path, Mendham", "Mendhamville Road", "Mendam Lake"}},
+		{name: "no match", req: &protos.SearchRequest{Query: "hoboken"}},
+		{
+			name: "bounds",
+			req: &protos.SearchRequest{
+				Query:  "mendham",
+				Bounds: &protos.Rectangle{Lo: &protos.Point{Latitude: 3, Longitude: 3}, Hi: &protos.Point{Latitude: 2, Longitude: 2}},
+			},
+			want: []string{"Mendhamville Road", "Mendam Lake"},
+		},
+		{name: "max results", req: &protos.SearchRequest{Query: "mendham", MaxResults: 1}, want: []string{"Patriots Path, Mendham"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.SearchFeatures(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("SearchFeatures: %v", err)
+			}
+			if got := resultNames(resp); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("results = %q, want %q", got, tt.want)
+			}
+			for i := 1; i < len(resp.Results); i++ {
+				if resp.Results[i].Score > resp.Results[i-1].Score {
+					t.Errorf("result %d scores %f, more than the one before it", i, resp.Results[i].Score)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchFeaturesMaxResults(t *testing.T) {
+	var features []*protos.Feature
+	for i := 0; i < maxSearchResults+50; i++ {
+		features = append(features, &protos.Feature{Name: fmt.Sprintf("Trail %d", i)})
+	}
+	s := &RouteGuideServerImpl{}
+	s.SetFeatures(features)
+	tests := []struct {
+		maxResults int32
+		want       int
+	}{
+		{maxResults: 0, want: defaultSearchResults},
+		{maxResults: 25, want: 25},
+		{maxResults: maxSearchResults + 1, want: maxSearchResults},
+		{maxResults: 1000, want: maxSearchResults},
+	}
+	for _, tt := range tests {
+		resp, err := s.SearchFeatures(context.Background(), &protos.SearchRequest{Query: "trail", MaxResults: tt.maxResults})
+		if err != nil {
+			t.Fatalf("SearchFeatures: %v", err)
+		}
+		if len(resp.Results) != tt.want {
+			t.Errorf("max_results %d gave %d results, want %d", tt.maxResults, len(resp.Results), tt.want)
+		}
+	}
+}
+
+func TestSearchFeaturesEmptyQuery(t *testing.T) {
+	s := &RouteGuideServerImpl{}
+	for _, query := range []string{"", "  ", ", -"} {
+		_, err := s.SearchFeatures(context.Background(), &protos.SearchRequest{Query: query})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("query %q: error = %v, want InvalidArgument", query, err)
+		}
+	}
+	// nothing loaded yet
+	resp, err := s.SearchFeatures(context.Background(), &protos.SearchRequest{Query: "mendham"})
+	if err != nil || len(resp.Results) != 0 {
+		t.Errorf("SearchFeatures without features = %v, %v, want no results", resp, err)
+	}
+}
+
+// The index follows the features, a reload drops the old names.
+func TestSearchFeaturesAfterSetFeatures(t *testing.T) {
+	s := &RouteGuideServerImpl{}
+	s.SetFeatures([]*protos.Feature{{Name: "Patriots Path, Mendham"}})
+	s.SetFeatures([]*protos.Feature{{Name: "Kingston Ferry"}})
+	for query, want := range map[string][]string{"mendham": nil, "kingston": {"Kingston Ferry"}} {
+		resp, err := s.SearchFeatures(context.Background(), &protos.SearchRequest{Query: query})
+		if err != nil {
+			t.Fatalf("SearchFeatures: %v", err)
+		}
+		if got := resultNames(resp); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%q found %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{a: "mendham", b: "mendham", limit: 2, want: 0},
+		{a: "mendam", b: "mendham", limit: 2, want: 1},
+		{a: "kingston", b: "kinsgton", limit: 2, want: 2},
+		{a: "whippany", b: "whipany", limit: 1, want: 1},
+		// past the limit only limit+1 is known
+		{a: "mendham", b: "shohola", limit: 2, want: 3},
+		{a: "mend", b: "mendhamville", limit: 2, want: 3},
+		{a: "zürich", b: "zurich", limit: 1, want: 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("Patriots Path, Mendham, NJ 07945, USA")
+	want := []string{"patriots", "path", "mendham", "nj", "07945", "usa"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("tokenize = %q, want %q", got, want)
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+func resultNames(resp *protos.SearchResponse) []string {
+	var names []string
+	for _, r := range resp.Results {
+		names = append(names, r.Feature.Name)
+	}
+	return names
+}
@@ -5,14 +5,21 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"math"
+	"sort"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/golang/protobuf/proto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
+	"gitlab.com/ethanlewis787/fun-with-grpc/pagetoken"
 	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
 )
 
@@ -20,6 +27,25 @@ import (
 type RouteGuideServerImpl struct {
 	SavedFeatures []*protos.Feature
 	RouteNotes    map[string][]*protos.RouteNote
+	// DistanceMode selects how RecordRoute measures the distance between points.
+	DistanceMode DistanceMode
+	// MaxListResults bounds the features sent by a single ListFeatures or NearestFeatures call,
+	// DefaultMaxListResults is used when it is zero.
+	MaxListResults int
+
+	// mu guards SavedFeatures, byLocation and index so features can be reloaded while serving
+	mu         sync.RWMutex
+	byLocation []*protos.Feature
+	index      *searchIndex
+
+	// notesMu guards RouteNotes and chatters, every RouteChat stream writes to them
+	notesMu  sync.Mutex
+	chatters map[*chatter]struct{}
+
+	// drain is closed by Drain to wind down long lived streams
+	drainInit  sync.Once
+	drainClose sync.Once
+	drain      chan struct{}
 }
 
 // GetFeature returns the feature at the given point (simple RPC)
@@ -28,13 +54,20 @@ type RouteGuideServerImpl struct {
 // In the method we populate the feature with the appropriate information and then return it along with
 // an nil error to tell gRPC that we've finished dealing  with the RPC and that the feature can be returned
 // to the client.
-func (s *RouteGuideServerImpl) GetFeature(ctx context.Context, point *protos.Point) (*protos.Feature, error) {
-	for _, feature := range s.SavedFeatures {
+// The optional read_mask trims the returned feature down to the fields the client asked for.
+func (s *RouteGuideServerImpl) GetFeature(ctx context.Context, req *protos.GetFeatureRequest) (*protos.Feature, error) {
+	if err := validateFeatureMask(req.ReadMask); err != nil {
+		return nil, err
+	}
+	point := &protos.Point{Latitude: req.Latitude, Longitude: req.Longitude}
+	for _, feature := range s.features() {
 		if proto.Equal(feature.Location, point) {
-			return feature, nil
+			traceFeatureLookup(ctx, point, feature)
+			return applyFeatureMask(feature, req.ReadMask), nil
 		}
 	}
-	return &protos.Feature{Location: point}, nil
+	traceFeatureLookup(ctx, point, nil)
+	return applyFeatureMask(&protos.Feature{Location: point}, req.ReadMask), nil
 }
 
 // ListFeatures lists all features contained within the given bounding rectangle (server side streaming)
@@ -42,13 +75,61 @@ func (s *RouteGuideServerImpl) GetFeature(ctx context.Context, point *protos.Poi
 // RouteGuide_ListFeaturesServer using its Send() method. Finally as in our simple RPC we return a nil error
 // to rell gRPC that we've finsihed writing responses. Should any error happen in this call, we return a non-nil error
 // The gRPC layer will transalte it into an appropriate RPC status to be sent on the wire.
-func (s *RouteGuideServerImpl) ListFeatures(rect *protos.Rectangle, stream protos.RouteGuide_ListFeaturesServer) error {
-	for _, feature := range s.SavedFeatures {
-		if inRange(feature.Location, rect) {
-			if err := stream.Send(feature); err != nil {
-				return err
+// Only features matching the optional attribute filter are sent.
+// Features are sent in a stable order so a call can be resumed with the next-page-token trailer of the
+// previous one. At most max_results features, capped at MaxListResults, are sent per call.
+func (s *RouteGuideServerImpl) ListFeatures(req *protos.ListFeaturesRequest, stream protos.RouteGuide_ListFeaturesServer) error {
+	if err := validateFeatureMask(req.ReadMask); err != nil {
+		return err
+	}
+	rect := &protos.Rectangle{Lo: req.Lo, Hi: req.Hi}
+	var after *pagetoken.Position
+	if req.PageToken != "" {
+		k, err := pagetoken.Decode(req.PageToken)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		after = &k
+	}
+	bound := s.MaxListResults
+	if bound <= 0 {
+		bound = DefaultMaxListResults
+	}
+	limit := bound
+	if req.MaxResults > 0 && int(req.MaxResults) < bound {
+		limit = int(req.MaxResults)
+	}
+
+	s.mu.RLock()
+	features := s.byLocation
+	s.mu.RUnlock()
+	start := 0
+	if after != nil {
+		// skip everything up to and including the last feature of the previous page
+		start = sort.Search(len(features), func(i int) bool {
+			return after.Less(pagetoken.Of(features[i]))
+		})
+	}
+	sent := 0
+	var last *protos.Feature
+	for _, feature := range features[start:] {
+		if !inRange(feature.Location, rect) || !matchesFilter(feature, req.Filter) {
+			continue
+		}
+		if sent == limit {
+			// there is at least one more match, tell the client where to resume
+			trailer := metadata.Pairs(pagetoken.NextPageTokenTrailer, pagetoken.Encode(pagetoken.Of(last)))
+			if limit == bound {
+				trailer.Set(pagetoken.TruncatedTrailer, "true")
 			}
+			stream.SetTrailer(trailer)
+			return nil
+		}
+		if err := stream.Send(applyFeatureMask(feature, req.ReadMask)); err != nil {
+			return err
 		}
+		sent++
+		last = feature
 	}
 	return nil
 }
@@ -65,7 +146,8 @@ func (s *RouteGuideServerImpl) ListFeatures(rect *protos.Rectangle, stream proto
 // i.e ( rpc RecordRoute(stream Point) returns (RouteSummary) {} ) <- less abstract :D
 func (s *RouteGuideServerImpl) RecordRoute(stream protos.RouteGuide_RecordRouteServer) error {
 	// Construct points for RouteSummary ( which is the return object )
-	var pointCount, featureCount, distance int32
+	var pointCount, featureCount int32
+	var distance float64
 	var lastPoint *protos.Point
 	startTime := time.Now()
 	for {
@@ -76,10 +158,11 @@ func (s *RouteGuideServerImpl) RecordRoute(stream protos.RouteGuide_RecordRouteS
 			endTime := time.Now()
 			// send summary and close the stream
 			err := stream.SendAndClose(&protos.RouteSummary{
-				PointCount:   pointCount,
-				FeatureCount: featureCount,
-				Distance:     distance,
-				ElapsedTime:  int32(endTime.Sub(startTime).Seconds()),
+				PointCount:     pointCount,
+				FeatureCount:   featureCount,
+				Distance:       saturateInt32(distance),
+				ElapsedTime:    int32(endTime.Sub(startTime).Seconds()),
+				DistanceMeters: distance,
 			})
 			// gRPC layer will handle status code if this is non-nil
 			return err
@@ -88,13 +171,14 @@ func (s *RouteGuideServerImpl) RecordRoute(stream protos.RouteGuide_RecordRouteS
 			return err
 		}
 		pointCount++
-		for _, feature := range s.SavedFeatures {
+		for _, feature := range s.features() {
 			if proto.Equal(feature.Location, point) {
 				featureCount++
+				traceFeatureLookup(stream.Context(), point, feature)
 			}
 		}
 		if lastPoint != nil {
-			distance += calcDistance(lastPoint, point)
+			distance += s.DistanceMode.Distance(lastPoint, point)
 		}
 		lastPoint = point
 	}
@@ -109,22 +193,49 @@ func (s *RouteGuideServerImpl) RecordRoute(stream protos.RouteGuide_RecordRouteS
 // — the streams operate completely independently.
 // note : more abstraction but same notes as client
 // rpc RouteChat(stream RouteNote) returns (stream RouteNote) {}
+// Notes left by other chats are sent to every open stream as they arrive, so a chatter sees them
+// without leaving a note first. A stream is sent every note once, the answer to a note holds the
+// notes at its location the stream wasn't sent yet and ends with the note itself.
+// Recv blocks, so it runs in its own goroutine and the loop below can also watch for Drain
+// and end the stream with Unavailable, telling the client to reconnect elsewhere.
 func (s *RouteGuideServerImpl) RouteChat(stream protos.RouteGuide_RouteChatServer) error {
-	for {
-		in, err := stream.Recv()
-		if err == io.EOF {
-			return nil
-		}
-		if err != nil {
-			return err
+	type received struct {
+		note *protos.RouteNote
+		err  error
+	}
+	// join before reading, notes left by others from now on are queued for this stream
+	c := s.joinChat()
+	defer s.leaveChat(c)
+	notes := make(chan received)
+	go func() {
+		for {
+			in, err := stream.Recv()
+			select {
+			case notes <- received{note: in, err: err}:
+			case <-stream.Context().Done():
+				return
+			}
+			if err != nil {
+				return
+			}
 		}
-		key := serialize(in.Location)
-		if _, ok := s.RouteNotes[key]; !ok {
-			s.RouteNotes[key] = []*protos.RouteNote{in}
-		} else {
-			s.RouteNotes[key] = append(s.RouteNotes[key], in)
+	}()
+	for {
+		select {
+		case <-s.draining():
+			return status.Errorf(codes.Unavailable, "server is shutting down")
+		case <-c.wake:
+			// notes left by other chats
+		case r := <-notes:
+			if r.err == io.EOF {
+				return nil
+			}
+			if r.err != nil {
+				return r.err
+			}
+			s.leaveNote(c, r.note)
 		}
-		for _, note := range s.RouteNotes[key] {
+		for _, note := range c.take() {
 			if err := stream.Send(note); err != nil {
 				return err
 			}
@@ -132,19 +243,150 @@ func (s *RouteGuideServerImpl) RouteChat(stream protos.RouteGuide_RouteChatServe
 	}
 }
 
+// SearchFeatures searches feature names for the words in the query (simple RPC)
+// Each word matches indexed name terms exactly, as a prefix ( "mend" finds "Mendham" ) or within a
+// small edit distance ( "mendam" finds "Mendham" ). Results are ranked by score, best match first,
+// and can be limited to a bounding rectangle.
+func (s *RouteGuideServerImpl) SearchFeatures(ctx context.Context, req *protos.SearchRequest) (*protos.SearchResponse, error) {
+	if len(tokenize(req.Query)) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "query must contain at least one word")
+	}
+	maxResults := int(req.MaxResults)
+	if maxResults <= 0 {
+		maxResults = defaultSearchResults
+	}
+	if maxResults > maxSearchResults {
+		maxResults = maxSearchResults
+	}
+	s.mu.RLock()
+	index := s.index
+	s.mu.RUnlock()
+	if index == nil {
+		return &protos.SearchResponse{}, nil
+	}
+	return &protos.SearchResponse{Results: index.search(req.Query, req.Bounds, maxResults)}, nil
+}
+
+// NearestFeatures streams the features closest to the given point, nearest first (server side streaming)
+// Distances are measured with the server's DistanceMode. At most max_results features, capped at
+// MaxListResults, are sent. Features further than max_distance_meters or not matching the filter are left out.
+func (s *RouteGuideServerImpl) NearestFeatures(req *protos.NearestFeaturesRequest, stream protos.RouteGuide_NearestFeaturesServer) error {
+	if req.Location == nil {
+		return status.Errorf(codes.InvalidArgument, "location is required")
+	}
+	if err := validateFeatureMask(req.ReadMask); err != nil {
+		return err
+	}
+	limit := int(req.MaxResults)
+	if limit <= 0 {
+		limit = defaultNearestResults
+	}
+	bound := s.MaxListResults
+	if bound <= 0 {
+		bound = DefaultMaxListResults
+	}
+	if limit > bound {
+		limit = bound
+	}
+
+	type nearby struct {
+		feature  *protos.Feature
+		distance float64
+	}
+	var candidates []nearby
+	for _, feature := range s.features() {
+		if !matchesFilter(feature, req.Filter) {
+			continue
+		}
+		d := s.DistanceMode.Distance(req.Location, feature.Location)
+		if req.MaxDistanceMeters > 0 && d > req.MaxDistanceMeters {
+			continue
+		}
+		candidates = append(candidates, nearby{feature: feature, distance: d})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	for _, c := range candidates {
+		if err := stream.Send(applyFeatureMask(c.feature, req.ReadMask)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // LoadFeatures loads features from a JSON file.
-func (s *RouteGuideServerImpl) LoadFeatures(filePath string) {
+// It can be called again to reload the features, the search index is rebuilt each time.
+// On error the previously loaded features are kept.
+func (s *RouteGuideServerImpl) LoadFeatures(filePath string) error {
 	file, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		log.Fatalf("Failed to load default features: %v", err)
+		return fmt.Errorf("failed to load features: %v", err)
 	}
-	if err := json.Unmarshal(file, &s.SavedFeatures); err != nil {
-		log.Fatalf("Failed to load default features: %v", err)
+	var features []*protos.Feature
+	if err := json.Unmarshal(file, &features); err != nil {
+		return fmt.Errorf("failed to load features: %v", err)
+	}
+	s.SetFeatures(features)
+	return nil
+}
+
+// SetFeatures replaces the saved features and rebuilds the search index and ListFeatures ordering.
+func (s *RouteGuideServerImpl) SetFeatures(features []*protos.Feature) {
+	index := newSearchIndex(features)
+	byLocation := sortByLocation(features)
+	s.mu.Lock()
+	s.SavedFeatures = features
+	s.byLocation = byLocation
+	s.index = index
+	s.mu.Unlock()
+}
+
+// FeatureCount returns the number of loaded features
+func (s *RouteGuideServerImpl) FeatureCount() int {
+	return len(s.features())
+}
+
+// RouteNoteCount returns the number of RouteNotes stored across all locations
+func (s *RouteGuideServerImpl) RouteNoteCount() int {
+	s.notesMu.Lock()
+	defer s.notesMu.Unlock()
+	count := 0
+	for _, notes := range s.RouteNotes {
+		count += len(notes)
 	}
+	return count
+}
+
+// Drain tells open RouteChat streams to wind down ahead of a shutdown. They end with an
+// Unavailable status so clients know to reconnect. It is safe to call more than once.
+func (s *RouteGuideServerImpl) Drain() {
+	drain := s.draining()
+	s.drainClose.Do(func() {
+		close(drain)
+	})
 }
 
 // ------ Unexported helpers ------ //
 
+// draining returns the channel closed by Drain
+func (s *RouteGuideServerImpl) draining() chan struct{} {
+	s.drainInit.Do(func() {
+		s.drain = make(chan struct{})
+	})
+	return s.drain
+}
+
+// features returns the currently loaded features
+func (s *RouteGuideServerImpl) features() []*protos.Feature {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.SavedFeatures
+}
+
 // inRange checks if point is in bounds of Rectangle
 func inRange(point *protos.Point, rect *protos.Rectangle) bool {
 	left := math.Min(float64(rect.Lo.Longitude), float64(rect.Hi.Longitude))
@@ -161,32 +403,30 @@ func inRange(point *protos.Point, rect *protos.Rectangle) bool {
 	return false
 }
 
-// toRadians converts a number to radian
-func toRadians(num float64) float64 {
-	return num * math.Pi / float64(180)
-}
-
-// calcDistance calculates the distance between two points using the "haversine" formula.
-// This code was taken from http://www.movable-type.co.uk/scripts/latlong.html.
-func calcDistance(p1 *protos.Point, p2 *protos.Point) int32 {
-	const CordFactor float64 = 1e7
-	const R float64 = float64(6371000) // metres
-	lat1 := float64(p1.Latitude) / CordFactor
-	lat2 := float64(p2.Latitude) / CordFactor
-	lng1 := float64(p1.Longitude) / CordFactor
-	lng2 := float64(p2.Longitude) / CordFactor
-	φ1 := toRadians(lat1)
-	φ2 := toRadians(lat2)
-	Δφ := toRadians(lat2 - lat1)
-	Δλ := toRadians(lng2 - lng1)
-
-	a := math.Sin(Δφ/2)*math.Sin(Δφ/2) +
-		math.Cos(φ1)*math.Cos(φ2)*
-			math.Sin(Δλ/2)*math.Sin(Δλ/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	distance := R * c
-	return int32(distance)
+// saturateInt32 clamps a distance to the int32 range of the deprecated RouteSummary.distance field
+func saturateInt32(num float64) int32 {
+	if num >= math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int32(num)
+}
+
+// traceFeatureLookup records a feature lookup as an event on the RPC's span.
+// feature is nil when nothing is known at the point.
+func traceFeatureLookup(ctx context.Context, point *protos.Point, feature *protos.Feature) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		attribute.Int("point.latitude", int(point.Latitude)),
+		attribute.Int("point.longitude", int(point.Longitude)),
+		attribute.Bool("feature.found", feature != nil),
+	}
+	if feature != nil {
+		attrs = append(attrs, attribute.String("feature.name", feature.Name))
+	}
+	span.AddEvent("feature lookup", trace.WithAttributes(attrs...))
 }
 
 func serialize(point *protos.Point) string {
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/ethanlewis787/fun-with-grpc/protos"
+)
+
+func TestSaturateInt32(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want int32
+	}{
+		{in: 0, want: 0},
+		{in: 1234.9, want: 1234},
+		{in: math.MaxInt32 - 1, want: math.MaxInt32 - 1},
+		{in: math.MaxInt32, want: math.MaxInt32},
+		{in: 3e9, want: math.MaxInt32},
+		{in: math.Inf(1), want: math.MaxInt32},
+	}
+	for _, tt := range tests {
+		if got := saturateInt32(tt.in); got != tt.want {
+			t.Errorf("saturateInt32(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+// A route longer than the int32 distance field can hold keeps its exact length in distance_meters.
+func TestRecordRouteClampsDeprecatedDistance(t *testing.T) {
+	// every leg from one side of the equator to the other is about 20,015 km
+	var points []*protos.Point
+	for i := 0; i < 120; i++ {
+		points = append(points, point(0, 0), point(0, 180))
+	}
+	stream := &recordRouteStream{points: points}
+	s := &RouteGuideServerImpl{}
+	if err := s.RecordRoute(stream); err != nil {
+		t.Fatalf("RecordRoute: %v", err)
+	}
+	summary := stream.summary
+	if summary.DistanceMeters <= math.MaxInt32 {
+		t.Fatalf("distance_meters = %f, want more than %d for this route", summary.DistanceMeters, math.MaxInt32)
+	}
+	if summary.Distance != math.MaxInt32 {
+		t.Errorf("distance = %d, want it clamped to %d", summary.Distance, math.MaxInt32)
+	}
+	if summary.PointCount != int32(len(points)) {
+		t.Errorf("point_count = %d, want %d", summary.PointCount, len(points))
+	}
+}
+
+// Tags, category and properties are read from the feature file along with name and location.
+func TestLoadFeatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "features.json")
+	file := `[{
+    "location": {"latitude": 407838351, "longitude": -746143763},
+    "name": "Patriots Path, Mendham, NJ 07945, USA",
+    "category": "park",
+    "tags": ["trail", "dogs-allowed"],
+    "properties": {"surface": "gravel", "opening_hours": "24/7"}
+}, {
+    "location": {"latitude": 408122808, "longitude": -743999179},
+    "name": "101 New Jersey 10, Whippany, NJ 07981, USA"
+}]`
+	if err := ioutil.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := &RouteGuideServerImpl{}
+	if err := s.LoadFeatures(path); err != nil {
+		t.Fatalf("LoadFeatures: %v", err)
+	}
+	want := []*protos.Feature{
+		{
+			Name:       "Patriots Path, Mendham, NJ 07945, USA",
+			Location:   &protos.Point{Latitude: 407838351, Longitude: -746143763},
+			Category:   "park",
+			Tags:       []string{"trail", "dogs-allowed"},
+			Properties: map[string]string{"surface": "gravel", "opening_hours": "24/7"},
+		},
+		{
+			Name:     "101 New Jersey 10, Whippany, NJ 07981, USA",
+			Location: &protos.Point{Latitude: 408122808, Longitude: -743999179},
+		},
+	}
+	got := s.features()
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d features, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("feature %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// a broken file keeps what was loaded
+	if err := ioutil.WriteFile(path, []byte(`[{"name": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LoadFeatures(path); err == nil {
+		t.Error("LoadFeatures accepted a broken file")
+	}
+	if n := s.FeatureCount(); n != len(want) {
+		t.Errorf("%d features after a failed reload, want %d", n, len(want))
+	}
+}
+
+func TestNearestFeatures(t *testing.T) {
+	s := &RouteGuideServerImpl{MaxListResults: 3}
+	s.SetFeatures([]*protos.Feature{
+		{Name: "three", Location: point(0, 3), Category: "park"},
+		{Name: "one", Location: point(0, 1)},
+		{Name: "five", Location: point(0, 5), Category: "park"},
+		{Name: "two", Location: point(0, 2), Category: "park"},
+		{Name: "four", Location: point(0, 4)},
+	})
+	// a degree of longitude on the equator is a little over 111km
+	tests := []struct {
+		name string
+		req  *protos.NearestFeaturesRequest
+		want []string
+	}{
+		{name: "nearest first", req: &protos.NearestFeaturesRequest{MaxResults: 2}, want: []string{"one", "two"}},
+		{name: "capped at MaxListResults", req: &protos.NearestFeaturesRequest{MaxResults: 10}, want: []string{"one", "two", "three"}},
+		{name: "default limit capped", req: &protos.NearestFeaturesRequest{}, want: []string{"one", "two", "three"}},
+		{name: "max distance", req: &protos.NearestFeaturesRequest{MaxResults: 3, MaxDistanceMeters: 250e3}, want: []string{"one", "two"}},
+		{
+			name: "filter",
+			req:  &protos.NearestFeaturesRequest{MaxResults: 3, Filter: &protos.FeatureFilter{Category: "park"}},
+			want: []string{"two", "three", "five"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Location = point(0, 0)
+			stream := &nearestStream{}
+			if err := s.NearestFeatures(tt.req, stream); err != nil {
+				t.Fatalf("NearestFeatures: %v", err)
+			}
+			var got []string
+			for _, f := range stream.sent {
+				got = append(got, f.Name)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("sent %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("sent %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNearestFeaturesReadMask(t *testing.T) {
+	s := &RouteGuideServerImpl{}
+	s.SetFeatures([]*protos.Feature{{Name: "one", Location: point(0, 1), Category: "park"}})
+	stream := &nearestStream{}
+	req := &protos.NearestFeaturesRequest{Location: point(0, 0), ReadMask: &field_mask.FieldMask{Paths: []string{"name"}}}
+	if err := s.NearestFeatures(req, stream); err != nil {
+		t.Fatalf("NearestFeatures: %v", err)
+	}
+	if len(stream.sent) != 1 || !proto.Equal(stream.sent[0], &protos.Feature{Name: "one"}) {
+		t.Errorf("sent %v, want only the name", stream.sent)
+	}
+
+	tests := map[string]*protos.NearestFeaturesRequest{
+		"no location":       {},
+		"unknown mask path": {Location: point(0, 0), ReadMask: &field_mask.FieldMask{Paths: []string{"rating"}}},
+	}
+	for name, req := range tests {
+		if err := s.NearestFeatures(req, &nearestStream{}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: NearestFeatures = %v, want InvalidArgument", name, err)
+		}
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// nearestStream collects what NearestFeatures sends
+type nearestStream struct {
+	protos.RouteGuide_NearestFeaturesServer
+	sent []*protos.Feature
+}
+
+func (s *nearestStream) Send(feature *protos.Feature) error {
+	s.sent = append(s.sent, feature)
+	return nil
+}
+
+// recordRouteStream plays the client side of a RecordRoute call
+type recordRouteStream struct {
+	protos.RouteGuide_RecordRouteServer
+	points  []*protos.Point
+	summary *protos.RouteSummary
+}
+
+func (s *recordRouteStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *recordRouteStream) Recv() (*protos.Point, error) {
+	if len(s.points) == 0 {
+		return nil, io.EOF
+	}
+	p := s.points[0]
+	s.points = s.points[1:]
+	return p, nil
+}
+
+func (s *recordRouteStream) SendAndClose(summary *protos.RouteSummary) error {
+	s.summary = summary
+	return nil
+}
@@ -0,0 +1,221 @@
+// Package tlsconfig builds the crypto/tls configs used by fwgrpc-server and fwgrpc-client.
+// Certificates and CA bundles are read from disk and re-read when the files change, so
+// certificates can be rotated without restarting either binary.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReloadInterval is how often the certificate files are checked for changes.
+// Checks only happen during handshakes, so an idle process never touches the disk.
+var ReloadInterval = 10 * time.Second
+
+// ServerOptions holds the files used to configure the server side of TLS
+type ServerOptions struct {
+	// CertFile and KeyFile hold the server certificate chain and private key in PEM.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM bundle of CAs trusted to sign client certificates.
+	// Setting it turns on mutual TLS, clients without a valid certificate are rejected.
+	ClientCAFile string
+}
+
+// ClientOptions holds the files used to configure the client side of TLS
+type ClientOptions struct {
+	// CAFile is a PEM bundle of CAs trusted to sign the server certificate.
+	// The system roots are used when it is empty.
+	CAFile string
+	// CertFile and KeyFile hold the client certificate and key presented for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name checked against the server certificate.
+	ServerName string
+}
+
+// NewServerConfig returns a tls.Config that serves the reloadable certificate in opts
+func NewServerConfig(opts ServerOptions) (*tls.Config, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, fmt.Errorf("tls: both a certificate and a key are required")
+	}
+	cert, err := newCertReloader(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	base := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cert.getCertificate,
+		// gRPC needs h2, gRPC-Web and the gateway also serve HTTP/1.1
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if opts.ClientCAFile == "" {
+		return base, nil
+	}
+	clientCAs, err := newPoolReloader(opts.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	base.ClientAuth = tls.RequireAndVerifyClientCert
+	// ClientCAs can't be swapped on a live config, hand out a copy of base with the current
+	// pool per handshake instead. The copy keeps everything else, ALPN included.
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool, err := clientCAs.getPool()
+		if err != nil {
+			return nil, err
+		}
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = pool
+		return c, nil
+	}
+	return base, nil
+}
+
+// NewClientConfig returns a tls.Config that verifies the server against opts.CAFile and
+// presents the reloadable client certificate when one is given.
+func NewClientConfig(opts ClientOptions) (*tls.Config, error) {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, fmt.Errorf("tls: a client certificate needs both a certificate and a key")
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: opts.ServerName,
+	}
+	if opts.CAFile != "" {
+		// the server CA is only read once, the client is short lived compared to the server
+		pool, err := loadPool(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if opts.CertFile != "" {
+		cert, err := newCertReloader(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.getCertificate(nil)
+		}
+	}
+	return config, nil
+}
+
+// ------ Unexported helpers ------ //
+
+// watchedFiles remembers the modification times of a set of files
+type watchedFiles struct {
+	paths     []string
+	modTimes  []time.Time
+	lastCheck time.Time
+}
+
+// changed reports whether any file changed since the last call. The files are
+// stat'd at most once per ReloadInterval.
+func (w *watchedFiles) changed(now time.Time) bool {
+	if now.Sub(w.lastCheck) < ReloadInterval {
+		return false
+	}
+	w.lastCheck = now
+	changed := false
+	for i, path := range w.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			// keep serving what we have, the file may be mid rotation
+			continue
+		}
+		if !info.ModTime().Equal(w.modTimes[i]) {
+			w.modTimes[i] = info.ModTime()
+			changed = true
+		}
+	}
+	return changed
+}
+
+func newWatchedFiles(paths ...string) *watchedFiles {
+	w := &watchedFiles{paths: paths, modTimes: make([]time.Time, len(paths))}
+	w.changed(time.Now())
+	return w
+}
+
+// certReloader holds a key pair and reloads it when either file changes
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu    sync.Mutex
+	files *watchedFiles
+	cert  *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: failed to load key pair: %v", err)
+	}
+	return &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		files:    newWatchedFiles(certFile, keyFile),
+		cert:     &cert,
+	}, nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.files.changed(time.Now()) {
+		// a half written pair fails to load, keep the old one until the next check
+		if cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile); err == nil {
+			r.cert = &cert
+		}
+	}
+	return r.cert, nil
+}
+
+// poolReloader holds a CA bundle and reloads it when the file changes
+type poolReloader struct {
+	caFile string
+
+	mu    sync.Mutex
+	files *watchedFiles
+	pool  *x509.CertPool
+}
+
+func newPoolReloader(caFile string) (*poolReloader, error) {
+	pool, err := loadPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+	return &poolReloader{caFile: caFile, files: newWatchedFiles(caFile), pool: pool}, nil
+}
+
+func (r *poolReloader) getPool() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.files.changed(time.Now()) {
+		if pool, err := loadPool(r.caFile); err == nil {
+			r.pool = pool
+		}
+	}
+	return r.pool, nil
+}
+
+// loadPool reads a PEM bundle of CA certificates
+func loadPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: failed to read CA bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tls: no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
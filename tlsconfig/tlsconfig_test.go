@@ -0,0 +1,240 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMutualTLSNegotiatesALPN(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	ca.issue(t, "localhost", dir, "server")
+	ca.issue(t, "client", dir, "client")
+	ca.writeCert(t, filepath.Join(dir, "ca.pem"))
+
+	serverConfig := newServerConfig(t, dir)
+	clientConfig := newClientConfig(t, dir, "client")
+	clientConfig.NextProtos = []string{"h2"}
+	state, err := handshake(serverConfig, clientConfig)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if state.NegotiatedProtocol != "h2" {
+		t.Errorf("negotiated protocol = %q, want h2", state.NegotiatedProtocol)
+	}
+
+	// clients without a certificate are turned away
+	anonymous := newClientConfig(t, dir, "")
+	if _, err := handshake(serverConfig, anonymous); err == nil {
+		t.Error("handshake without a client certificate succeeded")
+	}
+}
+
+func TestReloadsRotatedFiles(t *testing.T) {
+	defer func(interval time.Duration) { ReloadInterval = interval }(ReloadInterval)
+	ReloadInterval = 0
+
+	dir := t.TempDir()
+	oldCA := newTestCA(t, "old ca")
+	oldCA.issue(t, "localhost", dir, "server")
+	oldCA.issue(t, "client", dir, "client")
+	oldCA.writeCert(t, filepath.Join(dir, "ca.pem"))
+
+	serverConfig := newServerConfig(t, dir)
+	clientConfig := newClientConfig(t, dir, "client")
+	state, err := handshake(serverConfig, clientConfig)
+	if err != nil {
+		t.Fatalf("handshake before rotation: %v", err)
+	}
+	oldSerial := state.PeerCertificates[0].SerialNumber
+
+	// rotate everything to a new CA, the client trusts both while the server moves over
+	newCA := newTestCA(t, "new ca")
+	newCA.issue(t, "localhost", dir, "server")
+	newCA.issue(t, "client", dir, "client")
+	writeBundle(t, filepath.Join(dir, "ca.pem"), oldCA, newCA)
+	touch(t, dir, "server.pem", "server-key.pem", "client.pem", "client-key.pem", "ca.pem")
+	clientConfig = newClientConfig(t, dir, "client")
+
+	state, err = handshake(serverConfig, clientConfig)
+	if err != nil {
+		t.Fatalf("handshake after rotation: %v", err)
+	}
+	if state.PeerCertificates[0].SerialNumber.Cmp(oldSerial) == 0 {
+		t.Error("server still presents the certificate from before the rotation")
+	}
+	if issuer := state.PeerCertificates[0].Issuer.CommonName; issuer != "new ca" {
+		t.Errorf("server certificate issued by %q, want new ca", issuer)
+	}
+
+	// dropping the old CA from the client CA bundle locks out clients it signed
+	oldCA.issue(t, "client", dir, "old-client")
+	newCA.writeCert(t, filepath.Join(dir, "ca.pem"))
+	touch(t, dir, "ca.pem")
+	if _, err := handshake(serverConfig, newClientConfig(t, dir, "old-client")); err == nil {
+		t.Error("client signed by the removed CA was accepted")
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var serial int64
+
+func nextSerial() *big.Int {
+	serial++
+	return big.NewInt(serial)
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          nextSerial(),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue writes a key pair for name signed by ca to dir/<file>.pem and dir/<file>-key.pem
+func (ca *testCA) issue(t *testing.T, name, dir, file string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: nextSerial(),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, file+".pem"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, file+"-key.pem"), "EC PRIVATE KEY", keyDER)
+}
+
+func (ca *testCA) writeCert(t *testing.T, path string) {
+	writeBundle(t, path, ca)
+}
+
+func writeBundle(t *testing.T, path string, cas ...*testCA) {
+	var bundle []byte
+	for _, ca := range cas {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...)
+	}
+	if err := ioutil.WriteFile(path, bundle, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// touch moves the modification times forward, rewrites within the file system's timestamp
+// granularity would otherwise go unnoticed
+func touch(t *testing.T, dir string, files ...string) {
+	future := time.Now().Add(time.Duration(serial) * time.Second)
+	for _, file := range files {
+		if err := os.Chtimes(filepath.Join(dir, file), future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newServerConfig(t *testing.T, dir string) *tls.Config {
+	config, err := NewServerConfig(ServerOptions{
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server-key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	})
+	if err != nil {
+		t.Fatalf("NewServerConfig: %v", err)
+	}
+	return config
+}
+
+// newClientConfig trusts dir/ca.pem and presents dir/<file>.pem, no certificate when file is empty
+func newClientConfig(t *testing.T, dir, file string) *tls.Config {
+	opts := ClientOptions{CAFile: filepath.Join(dir, "ca.pem"), ServerName: "localhost"}
+	if file != "" {
+		opts.CertFile = filepath.Join(dir, file+".pem")
+		opts.KeyFile = filepath.Join(dir, file+"-key.pem")
+	}
+	config, err := NewClientConfig(opts)
+	if err != nil {
+		t.Fatalf("NewClientConfig: %v", err)
+	}
+	return config
+}
+
+// handshake runs a TLS handshake between the two configs and returns the client's view of it.
+// The error is the server's when the server rejected the client.
+func handshake(serverConfig, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	serverErr := make(chan error, 1)
+	go func() {
+		server := tls.Server(serverConn, serverConfig)
+		err := server.Handshake()
+		if err == nil {
+			// TLS 1.3 clients only learn about a rejected certificate on their first read
+			_, err = server.Write([]byte{0})
+		}
+		serverErr <- err
+		serverConn.Close()
+	}()
+	client := tls.Client(clientConn, clientConfig)
+	err := client.Handshake()
+	if err == nil {
+		_, err = client.Read(make([]byte, 1))
+	}
+	if sErr := <-serverErr; sErr != nil {
+		return tls.ConnectionState{}, sErr
+	}
+	return client.ConnectionState(), err
+}
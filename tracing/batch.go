@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"google.golang.org/grpc"
+)
+
+// tracerName identifies spans created by this package
+const tracerName = "gitlab.com/ethanlewis787/fun-with-grpc/tracing"
+
+// StreamServerInterceptor groups the messages of a streaming RPC into child spans of
+// batchSize messages, so a slow stretch of a long RecordRoute or RouteChat shows up on
+// its own instead of being hidden in one long RPC span.
+func StreamServerInterceptor(batchSize int) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		bs := &batchingStream{ServerStream: ss, name: info.FullMethod + "/batch", size: batchSize}
+		err := handler(srv, bs)
+		bs.mu.Lock()
+		bs.endBatch()
+		bs.mu.Unlock()
+		return err
+	}
+}
+
+// ------ Unexported helpers ------ //
+
+// batchingStream opens a span on the first message of a batch and ends it after size messages.
+// Sends and receives may happen on different goroutines, mu guards the current batch.
+type batchingStream struct {
+	grpc.ServerStream
+	name string
+	size int
+
+	mu       sync.Mutex
+	span     trace.Span
+	sent     int
+	received int
+	batches  int
+}
+
+func (s *batchingStream) SendMsg(msg interface{}) error {
+	err := s.ServerStream.SendMsg(msg)
+	if err == nil {
+		s.count(func() { s.sent++ })
+	}
+	return err
+}
+
+func (s *batchingStream) RecvMsg(msg interface{}) error {
+	err := s.ServerStream.RecvMsg(msg)
+	if err == nil {
+		s.count(func() { s.received++ })
+	}
+	return err
+}
+
+// count records one message in the current batch, starting and ending batches as needed
+func (s *batchingStream) count(inc func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.span == nil {
+		_, s.span = otel.Tracer(tracerName).Start(s.ServerStream.Context(), s.name,
+			trace.WithAttributes(attribute.Int("batch.index", s.batches)))
+		s.batches++
+	}
+	inc()
+	if s.sent+s.received >= s.size {
+		s.endBatch()
+	}
+}
+
+// endBatch ends the current batch span, if any. mu must be held.
+func (s *batchingStream) endBatch() {
+	if s.span == nil {
+		return
+	}
+	s.span.SetAttributes(
+		attribute.Int("messages.sent", s.sent),
+		attribute.Int("messages.received", s.received),
+	)
+	s.span.End()
+	s.span = nil
+	s.sent, s.received = 0, 0
+}
@@ -0,0 +1,112 @@
+// Package tracing sets up OpenTelemetry for both binaries. Spans are created per RPC by the
+// otelgrpc stats handlers, which also carry the trace context across in gRPC metadata.
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/net/context"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"google.golang.org/grpc"
+)
+
+// Options selects where spans are exported to
+type Options struct {
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string
+	// Exporter is one of "stdout", "file", "otlp" or "none"
+	Exporter string
+	// FilePath is where the "file" exporter writes spans, one JSON document per span
+	FilePath string
+	// OTLPEndpoint is the host:port of an OTLP/gRPC collector for the "otlp" exporter
+	OTLPEndpoint string
+	// OTLPInsecure sends spans to the collector without TLS
+	OTLPInsecure bool
+}
+
+// Setup installs the global tracer provider and the W3C trace context propagator.
+// The returned function flushes buffered spans and must be called before exiting.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	exporter, closer, err := newExporter(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	if exporter == nil {
+		// nothing to export to, keep the no-op provider but still propagate incoming context
+		return func(context.Context) error { return nil }, nil
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(opts.ServiceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}
+
+// ServerOption creates a span for every RPC the server handles
+func ServerOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler())
+}
+
+// DialOption creates a span for every RPC the client makes and propagates it to the server
+func DialOption() grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler())
+}
+
+// ------ Unexported helpers ------ //
+
+// newExporter builds the exporter named by opts, the closer is non nil when a file was opened
+func newExporter(ctx context.Context, opts Options) (sdktrace.SpanExporter, io.Closer, error) {
+	switch opts.Exporter {
+	case "", "none":
+		return nil, nil, nil
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exporter, nil, err
+	case "file":
+		if opts.FilePath == "" {
+			return nil, nil, fmt.Errorf("tracing: the file exporter needs a file path")
+		}
+		file, err := os.OpenFile(opts.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return exporter, file, nil
+	case "otlp":
+		clientOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.OTLPEndpoint)}
+		if opts.OTLPInsecure {
+			clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, clientOpts...)
+		return exporter, nil, err
+	}
+	return nil, nil, fmt.Errorf("tracing: unknown exporter %q", opts.Exporter)
+}